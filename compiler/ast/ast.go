@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
 	"strings"
 
 	"monkey/token"
@@ -10,7 +11,8 @@ import (
 // simple node interface
 type Node interface {
 	TokenLiteral() string
-	String() string // method for printing and debugging
+	String() string      // method for printing and debugging
+	Pos() token.Position // position of the node token in the source
 }
 
 // node that represents a statemet (let, return, etc)
@@ -30,9 +32,10 @@ type Program struct {
 }
 
 type LetStatement struct {
-	Token token.Token // token.LET
+	Token token.Token // token.LET or token.CONST
 	Name  *Identifier // hold x in let x = 5;
 	Value Expression  // expression that produces the value, 5 in let x = 5;
+	Const bool        // bound with const, the binding cant be assigned
 }
 
 type ReturnStatement struct {
@@ -62,6 +65,12 @@ type Identifier struct {
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // set instead of Value when the literal doesnt fit in an int64
+}
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
 }
 
 type Boolean struct {
@@ -87,6 +96,14 @@ type InfixExpression struct {
 	Right    Expression
 }
 
+// x = 1, x += 1 or arr[i] = 1, the value of the expression is the assigned value
+type AssignExpression struct {
+	Token    token.Token // assignment operator token
+	Target   Expression  // identifier or index expression being assigned
+	Operator string      // = or a compound operator like +=
+	Value    Expression
+}
+
 type IfStatement struct {
 	Token       token.Token     // if token
 	Condition   Expression      // condition for if to be executed
@@ -94,10 +111,44 @@ type IfStatement struct {
 	Alternative *BlockStatement // { + code to be executed if doesnt passes
 }
 
+// if in expression position, like let x = if (a > b) { a } else { b };
+type IfExpression struct {
+	Token       token.Token     // if token
+	Condition   Expression      // condition for if to be executed
+	Consequence *BlockStatement // { + code to be executed if passes
+	Alternative *BlockStatement // { + code to be executed if doesnt passes
+}
+
+type WhileStatement struct {
+	Token     token.Token     // while token
+	Condition Expression      // loop runs while the condition is truthy
+	Body      *BlockStatement // { + code executed on every iteration
+}
+
+// for (init; condition; post) { body }, every clause is optional
+type ForStatement struct {
+	Token     token.Token     // for token
+	Init      Statement       // let or expression executed once before the loop
+	Condition Expression      // loop runs while the condition is truthy, forever when nil
+	Post      Statement       // let or expression executed after every iteration
+	Body      *BlockStatement // { + code executed on every iteration
+}
+
+type BreakStatement struct {
+	Token token.Token // break token
+}
+
+type ContinueStatement struct {
+	Token token.Token // continue token
+}
+
 type FunctionLiteral struct {
 	Token     token.Token     // fn token
 	Arguments []*Identifier   // list containing all of the arguments
+	Defaults  []Expression    // default value of each argument, nil for the required ones that come first
+	Rest      *Identifier     // ...rest parameter that collects the extra arguments into an array, can be nil
 	Body      *BlockStatement // function body
+	Name      string          // name of the binding when defined with let, used for recursive closures
 }
 
 type CallExpression struct {
@@ -106,6 +157,12 @@ type CallExpression struct {
 	Arguments []Expression
 }
 
+// ...array in the arguments of a call, passes the elements as separate arguments
+type SpreadExpression struct {
+	Token token.Token // ... token
+	Value Expression
+}
+
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
@@ -124,6 +181,7 @@ type HashLiteral struct {
 
 func (lt *LetStatement) statementNode()       {}
 func (lt *LetStatement) TokenLiteral() string { return lt.Token.Literal }
+func (lt *LetStatement) Pos() token.Position  { return lt.Token.Pos }
 
 func (lt *LetStatement) String() string {
 	var out bytes.Buffer
@@ -143,6 +201,7 @@ func (lt *LetStatement) String() string {
 
 func (rt *ReturnStatement) statementNode()       {}
 func (rt *ReturnStatement) TokenLiteral() string { return rt.Token.Literal }
+func (rt *ReturnStatement) Pos() token.Position  { return rt.Token.Pos }
 
 func (rt *ReturnStatement) String() string {
 	var out bytes.Buffer
@@ -160,6 +219,7 @@ func (rt *ReturnStatement) String() string {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
 
 // return whole expression as string
 func (es *ExpressionStatement) String() string {
@@ -171,6 +231,7 @@ func (es *ExpressionStatement) String() string {
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
@@ -184,26 +245,37 @@ func (bs *BlockStatement) String() string {
 
 func (id *Identifier) expressionNode()      {}
 func (id *Identifier) TokenLiteral() string { return id.Token.Literal }
+func (id *Identifier) Pos() token.Position  { return id.Token.Pos }
 
 func (id *Identifier) String() string { return id.Value }
 
 func (bl *Boolean) expressionNode()      {}
 func (bl *Boolean) TokenLiteral() string { return bl.Token.Literal }
+func (bl *Boolean) Pos() token.Position  { return bl.Token.Pos }
 
 func (bl *Boolean) String() string { return bl.Token.Literal }
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
 
 func (il *IntegerLiteral) String() string { return il.Token.Literal }
 
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
+
+func (fl *FloatLiteral) String() string { return fl.Token.Literal }
+
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
 
 func (sl *StringLiteral) String() string { return sl.Token.Literal }
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
@@ -218,6 +290,7 @@ func (pe *PrefixExpression) String() string {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return ie.Token.Pos }
 
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
@@ -230,8 +303,24 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position  { return ae.Token.Pos }
+
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 func (i *IfStatement) statementNode()       {}
 func (i *IfStatement) TokenLiteral() string { return i.Token.Literal }
+func (i *IfStatement) Pos() token.Position  { return i.Token.Pos }
 
 func (i *IfStatement) String() string {
 	var out bytes.Buffer
@@ -249,8 +338,81 @@ func (i *IfStatement) String() string {
 	return out.String()
 }
 
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos }
+
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ws.Token.Literal)
+
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos }
+
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(fs.Token.Literal + " (")
+
+	// let statements print their own semicolon
+	if fs.Init != nil {
+		out.WriteString(strings.TrimSuffix(fs.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Post != nil {
+		out.WriteString(strings.TrimSuffix(fs.Post.String(), ";"))
+	}
+
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BreakStatement) String() string       { return bs.Token.Literal + ";" }
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ContinueStatement) String() string       { return cs.Token.Literal + ";" }
+
+func (ie *IfExpression) expressionNode()      {}
+func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
+
+func (ie *IfExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString(ie.Token.Literal)
+
+	out.WriteString(ie.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ie.Consequence.String())
+
+	if ie.Alternative != nil {
+		out.WriteString("else ")
+		out.WriteString(ie.Alternative.String())
+	}
+
+	return out.String()
+}
+
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
 
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
@@ -258,14 +420,20 @@ func (fl *FunctionLiteral) String() string {
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
 
+	params := []string{}
 	for n, arg := range fl.Arguments {
-		out.WriteString(arg.String())
-		if n+1 == len(fl.Arguments) {
-			break
+		if n < len(fl.Defaults) && fl.Defaults[n] != nil {
+			params = append(params, arg.String()+" = "+fl.Defaults[n].String())
+		} else {
+			params = append(params, arg.String())
 		}
-		out.WriteString(", ")
 	}
 
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
+	}
+
+	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(")")
 	out.WriteString(fl.Body.String())
 	return out.String()
@@ -273,6 +441,7 @@ func (fl *FunctionLiteral) String() string {
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Token.Pos }
 
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
@@ -293,8 +462,14 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) Pos() token.Position  { return se.Token.Pos }
+func (se *SpreadExpression) String() string       { return "..." + se.Value.String() }
+
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
 
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
@@ -314,9 +489,11 @@ func (al *ArrayLiteral) String() string {
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
 
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
@@ -352,6 +529,13 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 // program string method, writing the value of each satement String() method and returning it
 func (p *Program) String() string {
 	var out bytes.Buffer
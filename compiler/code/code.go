@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+
+	"monkey/token"
 )
 
 type Instructions []byte
@@ -13,14 +15,75 @@ type Opcode byte
 const (
 	OpConstant Opcode = iota
 	OpPop
+	OpDup2
 	OpAdd
 	OpSub
 	OpMul
 	OpDiv
+	OpMod
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
 	OpTrue
 	OpFalse
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpGreaterThanOrEqual
+	OpLessThan
+	OpLessThanOrEqual
+	OpMinus
+	OpBang
+	OpJumpNotTruthy
+	OpJump
+	OpEnterLoop
+	OpExitLoop
+	OpUnwindLoop
+	OpNull
+	OpGetGlobal
+	OpSetGlobal
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpGetLocal
+	OpSetLocal
+	OpClosure
+	OpGetFree
+	OpSetFree
+	OpCaptureLocal
+	OpCaptureFree
+	OpCurrentClosure
+	OpSkipDefault
+	OpSpread
+	OpArray
+	OpHash
+	OpIndex
+	OpSetIndex
+	OpGetBuiltin
 )
 
+// source positions of the instructions, entries are sorted by offset
+type SourceMap []SourceEntry
+
+type SourceEntry struct {
+	Offset int // offset of the instruction in the instructions
+	Pos    token.Position
+}
+
+// position of the instruction that contains the offset
+func (sm SourceMap) Lookup(offset int) token.Position {
+	var pos token.Position
+	for _, e := range sm {
+		if e.Offset > offset {
+			break
+		}
+		pos = e.Pos
+	}
+	return pos
+}
+
 type Def struct {
 	Name         string
 	OperandBytes []int // number of bytes per operand
@@ -29,12 +92,68 @@ type Def struct {
 var definitions = map[Opcode]*Def{
 	OpConstant: {"OpConstant", []int{2}},
 	OpPop:      {"OpPop", []int{}},
+	OpDup2:     {"OpDup2", []int{}}, // pushes the two values on top of the stack again
 	OpAdd:      {"OpAdd", []int{}},
 	OpSub:      {"OpSub", []int{}},
 	OpMul:      {"OpMul", []int{}},
 	OpDiv:      {"OpDiv", []int{}},
-	OpTrue:     {"OpTrue", []int{}},
-	OpFalse:    {"OpFalse", []int{}},
+	OpMod:      {"OpMod", []int{}},
+
+	OpBitAnd:     {"OpBitAnd", []int{}},
+	OpBitOr:      {"OpBitOr", []int{}},
+	OpBitXor:     {"OpBitXor", []int{}},
+	OpShiftLeft:  {"OpShiftLeft", []int{}},
+	OpShiftRight: {"OpShiftRight", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+
+	OpEqual:              {"OpEqual", []int{}},
+	OpNotEqual:           {"OpNotEqual", []int{}},
+	OpGreaterThan:        {"OpGreaterThan", []int{}},
+	OpGreaterThanOrEqual: {"OpGreaterThanOrEqual", []int{}},
+	OpLessThan:           {"OpLessThan", []int{}},
+	OpLessThanOrEqual:    {"OpLessThanOrEqual", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}}, // operand is the absolute position to jump to
+	OpJump:          {"OpJump", []int{2}},
+	OpNull:          {"OpNull", []int{}},
+
+	// break and continue can leave an expression half evaluated, like in 1 + if (c) { break },
+	// so they unwind the stack to where it was when the loop was entered
+	OpEnterLoop:  {"OpEnterLoop", []int{}},
+	OpExitLoop:   {"OpExitLoop", []int{}},
+	OpUnwindLoop: {"OpUnwindLoop", []int{}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}}, // operand is the index in the globals store
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+
+	OpCall:        {"OpCall", []int{1}}, // operand is the number of arguments
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}}, // return with no value, leaves null on the stack
+	OpGetLocal:    {"OpGetLocal", []int{1}},
+	OpSetLocal:    {"OpSetLocal", []int{1}},
+
+	OpClosure:        {"OpClosure", []int{2, 1}}, // operands are the function constant index and the number of free variables
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpSetFree:        {"OpSetFree", []int{1}},
+	OpCaptureLocal:   {"OpCaptureLocal", []int{1}}, // pushes the storage of a local, not its value, for OpClosure
+	OpCaptureFree:    {"OpCaptureFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}}, // pushes the closure being executed, used for recursion
+
+	OpSkipDefault: {"OpSkipDefault", []int{1, 2}}, // operands are a parameter and the position after its default, jumps there when the argument was passed
+	OpSpread:      {"OpSpread", []int{}},          // marks the array on top of the stack so OpCall passes its elements as arguments
+
+	OpArray: {"OpArray", []int{2}}, // operand is the number of elements
+	OpHash:  {"OpHash", []int{2}},  // operand is the number of keys plus values
+	OpIndex: {"OpIndex", []int{}},
+
+	OpSetIndex: {"OpSetIndex", []int{}}, // pops the container, the index and the value, pushes the value back
+
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}}, // operand is the index in object.Builtins
 }
 
 func (is Instructions) String() string {
@@ -66,6 +185,8 @@ func (ins Instructions) fmtInstruction(def *Def, operands []int) string {
 		return def.Name
 	case 1:
 		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
 	}
 	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
 }
@@ -101,6 +222,8 @@ func Make(op Opcode, operands ...int) []byte {
 		switch opWidth {
 		case 2:
 			binary.BigEndian.PutUint16(instructions[offset:], uint16(o))
+		case 1:
+			instructions[offset] = byte(o)
 		}
 		offset += opWidth
 	}
@@ -117,6 +240,8 @@ func ReadOperands(def *Def, is Instructions) ([]int, int) {
 		switch w {
 		case 2:
 			op[i] = int(binary.BigEndian.Uint16(is[offset:]))
+		case 1:
+			op[i] = int(is[offset])
 		}
 		offset += w
 	}
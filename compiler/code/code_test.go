@@ -7,12 +7,16 @@ import (
 func TestInstructionsString(t *testing.T) {
 	instructions := []Instructions{
 		Make(OpAdd),
+		Make(OpGetLocal, 1),
 		Make(OpConstant, 2),
 		Make(OpConstant, 65535),
+		Make(OpSkipDefault, 1, 13),
 	}
 	expected := `0000 OpAdd
-0001 OpConstant 2
-0004 OpConstant 65535
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpSkipDefault 1 13
 `
 
 	concatted := Instructions{}
@@ -33,6 +37,8 @@ func TestReadOperands(t *testing.T) {
 		bytesRead int
 	}{
 		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpSkipDefault, []int{255, 65535}, 3},
 	}
 	for _, tt := range tests {
 		instruction := Make(tt.op, tt.operands...)
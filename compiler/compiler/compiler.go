@@ -5,27 +5,80 @@ import (
 	"monkey/ast"
 	"monkey/code"
 	"monkey/object"
-	"slices"
+	"monkey/token"
+	"sort"
+)
+
+// limits of the instruction operands, larger values would be truncated by code.Make
+const (
+	maxConstants = 1 << 16  // 2 byte operand of OpConstant and OpClosure
+	maxGlobals   = 1 << 16  // 2 byte operand of OpGetGlobal and OpSetGlobal
+	maxLocals    = 1 << 8   // 1 byte operand of OpGetLocal and OpSetLocal
+	maxFree      = 1<<8 - 1 // 1 byte free count of OpClosure
+	maxArguments = 1<<8 - 1 // 1 byte operand of OpCall
 )
 
 type Compiler struct {
-	instructions code.Instructions // hold the generated bytecode
-	constants    []object.Object   // constant pool
+	constants []object.Object // constant pool
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope // one scope per function being compiled, scopes[0] is the main program
+	scopeIndex int
+
+	pos token.Position // position of the node being compiled, recorded for every emitted instruction
+}
+
+type CompilationScope struct {
+	instructions        code.Instructions  // hold the generated bytecode
+	lastInstruction     EmittedInstruction // last emitted instruction
+	previousInstruction EmittedInstruction // instruction emitted before the last one
+	sourceMap           code.SourceMap
+	loops               []*loopJumps // loops being compiled, the innermost one is last
+}
+
+// jumps of the break and continue statements of a loop, back-patched once the loop is compiled
+type loopJumps struct {
+	breaks    []int
+	continues []int
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
 }
 
 type Bytecode struct { // what we will pass to the vm and make assertions
 	Instructions code.Instructions // instructions the compiler generated
 	Constants    []object.Object   // constants the compile already evaluated
+	SourceMap    code.SourceMap    // source positions of the main program instructions
 }
 
 func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	symbolTable := NewSymbolTable()
+	for i, def := range object.Builtins {
+		symbolTable.DefineBuiltin(i, def.Name)
+	}
+
 	return &Compiler{
-		instructions: code.Instructions{},
-		constants:    []object.Object{},
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
 	}
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
+	outerPos := c.pos
+	c.pos = node.Pos()
+	defer func() { c.pos = outerPos }()
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
@@ -41,7 +94,109 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		c.emit(code.OpPop)
 
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		if err := c.symbolTable.checkDeclaration(node.Name.Value); err != nil {
+			return c.newError("%s", err)
+		}
+
+		// a function bound with let refers to itself through the binding like in eval, so it
+		// sees later assignments to the name. the binding is defined first so the body resolves it
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok && !node.Const {
+			symbol, err := c.define(node.Name.Value, false)
+			if err != nil {
+				return err
+			}
+			if err := c.compileFunction(fn, false); err != nil {
+				return err
+			}
+
+			c.storeSymbol(symbol)
+			return nil
+		}
+
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		symbol, err := c.define(node.Name.Value, node.Const)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		c.emit(code.OpReturnValue)
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return c.newError("identifier not found: %s", node.Value)
+		}
+
+		c.loadSymbol(symbol)
+
+	case *ast.AssignExpression:
+		if err := c.compileAssign(node); err != nil {
+			return err
+		}
+
+	case *ast.IfStatement:
+		if err := c.compileIf(node.Condition, node.Consequence, node.Alternative); err != nil {
+			return err
+		}
+
+		// the statement form pops its value like an expression statement
+		c.emit(code.OpPop)
+
+	case *ast.IfExpression:
+		if err := c.compileIf(node.Condition, node.Consequence, node.Alternative); err != nil {
+			return err
+		}
+
+	case *ast.WhileStatement:
+		if err := c.compileLoop(nil, node.Condition, nil, node.Body); err != nil {
+			return err
+		}
+
+	case *ast.ForStatement:
+		if err := c.compileLoop(node.Init, node.Condition, node.Post, node.Body); err != nil {
+			return err
+		}
+
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return c.newError("break outside of loop")
+		}
+
+		c.emit(code.OpUnwindLoop)
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return c.newError("continue outside of loop")
+		}
+
+		c.emit(code.OpUnwindLoop)
+		loop.continues = append(loop.continues, c.emit(code.OpJump, 9999))
+
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogical(node)
+		}
+
 		if err := c.Compile(node.Left); err != nil {
 			return err
 		}
@@ -59,13 +214,97 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case "&":
+			c.emit(code.OpBitAnd)
+		case "|":
+			c.emit(code.OpBitOr)
+		case "^":
+			c.emit(code.OpBitXor)
+		case "<<":
+			c.emit(code.OpShiftLeft)
+		case ">>":
+			c.emit(code.OpShiftRight)
+		case ">":
+			c.emit(code.OpGreaterThan)
+		case ">=":
+			c.emit(code.OpGreaterThanOrEqual)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "<=":
+			c.emit(code.OpLessThanOrEqual)
+		case "==":
+			c.emit(code.OpEqual)
+		case "!=":
+			c.emit(code.OpNotEqual)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return c.newError("unknown operator %s", node.Operator)
 		}
 
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return c.newError("unknown operator %s", node.Operator)
+		}
+
+	case *ast.FunctionLiteral:
+		// the name is only set for functions bound with let or const, which the let statement
+		// compiles itself
+		if err := c.compileFunction(node, node.Name != ""); err != nil {
+			return err
+		}
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+
+		if len(node.Arguments) > maxArguments {
+			return c.newError("too many arguments in call: %d, max is %d", len(node.Arguments), maxArguments)
+		}
+
+		for _, arg := range node.Arguments {
+			if err := c.Compile(arg); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
+
+	case *ast.SpreadExpression:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		c.emit(code.OpSpread)
+
 	case *ast.IntegerLiteral:
-		integer := &object.Integer{Value: node.Value}
-		c.emit(code.OpConstant, c.addConstant(integer))
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = &object.BigInteger{Value: node.Big}
+		}
+		index, err := c.addConstant(integer)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpConstant, index)
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		index, err := c.addConstant(float)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpConstant, index)
 
 	case *ast.Boolean:
 		if node.Value {
@@ -73,30 +312,553 @@ func (c *Compiler) Compile(node ast.Node) error {
 		} else {
 			c.emit(code.OpFalse)
 		}
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		index, err := c.addConstant(str)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpConstant, index)
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		keys := []ast.Expression{}
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+
+		// pairs are stored in a map, sort them so the generated bytecode is deterministic
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, k := range keys {
+			if err := c.Compile(k); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Pairs[k]); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+
+		c.emit(code.OpIndex)
+	}
+	return nil
+}
+
+// compiles a block leaving its last value on the stack, or null when the block doesnt produce one
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// leaves the value of the taken branch on the stack, null when there is no alternative
+func (c *Compiler) compileIf(condition ast.Expression, consequence, alternative *ast.BlockStatement) error {
+	if err := c.Compile(condition); err != nil {
+		return err
+	}
+
+	// placeholder operand, back-patched once the consequence is compiled
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlockValue(consequence); err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(alternative); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compiles the function into a closure. with selfReference the name of the function resolves
+// to the closure being executed, only used for const bindings since they always hold it
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, selfReference bool) error {
+	c.enterScope()
+
+	if selfReference {
+		c.symbolTable.DefineFunctionName(node.Name)
+	}
+
+	params := []string{}
+	for _, arg := range node.Arguments {
+		if _, err := c.define(arg.Value, false); err != nil {
+			return err
+		}
+		params = append(params, arg.Value)
+	}
+
+	if node.Rest != nil {
+		if _, err := c.define(node.Rest.Value, false); err != nil {
+			return err
+		}
+		params = append(params, node.Rest.Value)
 	}
+
+	if err := c.compileDefaults(node.Defaults, params); err != nil {
+		return err
+	}
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+
+	// the last expression of the body is the implicit return value
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	instructions := c.leaveScope()
+
+	if len(freeSymbols) > maxFree {
+		return c.newError("too many captured bindings in function: %d, max is %d", len(freeSymbols), maxFree)
+	}
+
+	// pushes the captured bindings so OpClosure can move them into the closure
+	for _, s := range freeSymbols {
+		c.captureSymbol(s)
+	}
+
+	numDefaults := 0
+	for _, def := range node.Defaults {
+		if def != nil {
+			numDefaults++
+		}
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Arguments),
+		NumDefaults:   numDefaults,
+		Variadic:      node.Rest != nil,
+		SourceMap:     sourceMap,
+		Name:          node.Name,
+	}
+	index, err := c.addConstant(compiledFn)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpClosure, index, len(freeSymbols))
 	return nil
 }
 
+// compiles a loop that jumps back to its condition, init, condition and post are optional.
+// loops are statements, so like an if statement they leave null and pop it
+func (c *Compiler) compileLoop(init ast.Statement, condition ast.Expression, post ast.Statement, body *ast.BlockStatement) error {
+	if init != nil {
+		if err := c.Compile(init); err != nil {
+			return err
+		}
+	}
+
+	c.emit(code.OpEnterLoop)
+	loopStart := len(c.currentInstructions())
+
+	jumpNotTruthyPos := -1
+	if condition != nil {
+		if err := c.Compile(condition); err != nil {
+			return err
+		}
+
+		jumpNotTruthyPos = c.emit(code.OpJumpNotTruthy, 9999)
+	}
+
+	loop := &loopJumps{}
+	c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, loop)
+
+	// function literals in the body append scopes, so the scope is looked up again
+	err := c.Compile(body)
+	loops := c.scopes[c.scopeIndex].loops
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+	if err != nil {
+		return err
+	}
+
+	for _, pos := range loop.continues {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	if post != nil {
+		if err := c.Compile(post); err != nil {
+			return err
+		}
+	}
+
+	c.emit(code.OpJump, loopStart)
+
+	end := len(c.currentInstructions())
+	if jumpNotTruthyPos >= 0 {
+		c.changeOperand(jumpNotTruthyPos, end)
+	}
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, end)
+	}
+
+	c.emit(code.OpExitLoop)
+	c.emit(code.OpNull)
+	c.emit(code.OpPop)
+	return nil
+}
+
+// innermost loop of the function being compiled, nil outside of loops
+func (c *Compiler) currentLoop() *loopJumps {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+// operators applied by the compound assignments
+var assignOperators = map[string]code.Opcode{
+	"+=": code.OpAdd,
+	"-=": code.OpSub,
+	"*=": code.OpMul,
+	"/=": code.OpDiv,
+}
+
+// stores the value and loads it again, the assignment is an expression whose value is the assigned value
+func (c *Compiler) compileAssign(node *ast.AssignExpression) error {
+	op, compound := assignOperators[node.Operator]
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, err := c.symbolTable.ResolveAssignment(target.Value)
+		if err != nil {
+			return c.newError("%s", err)
+		}
+
+		if compound {
+			c.loadSymbol(symbol)
+		}
+
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		if compound {
+			c.emit(op)
+		}
+
+		c.storeSymbol(symbol)
+		c.loadSymbol(symbol)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+
+		// the container and the index are kept for OpSetIndex while the current element is read
+		if compound {
+			c.emit(code.OpDup2)
+			c.emit(code.OpIndex)
+		}
+
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		if compound {
+			c.emit(op)
+		}
+
+		c.emit(code.OpSetIndex)
+
+	default:
+		return c.newError("cannot assign to %s", node.Target.String())
+	}
+	return nil
+}
+
+// compiles && and || with jumps so the right side only runs when needed, the result is
+// always a boolean like in eval
+func (c *Compiler) compileLogical(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if node.Operator == "||" {
+		// left is truthy, the right side is skipped
+		c.emit(code.OpTrue)
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		if err := c.compileTruthiness(node.Right); err != nil {
+			return err
+		}
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+		return nil
+	}
+
+	if err := c.compileTruthiness(node.Right); err != nil {
+		return err
+	}
+
+	// left is not truthy, the right side is skipped
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	c.emit(code.OpFalse)
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compiles the expression and turns its value into a boolean with !!
+func (c *Compiler) compileTruthiness(node ast.Expression) error {
+	if err := c.Compile(node); err != nil {
+		return err
+	}
+
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	}
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+// pushes the storage of a captured binding instead of its value, so the closure and the
+// function that defines the binding see each other's assignments
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpCaptureFree, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
-		Instructions: c.instructions,
+		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
 	}
 }
 
-func (c *Compiler) addConstant(obj object.Object) int {
+// compile errors use the same error object as runtime errors, positioned at the node being compiled
+func (c *Compiler) newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Value: fmt.Sprintf(format, a...), Pos: c.pos}
+}
+
+func (c *Compiler) addConstant(obj object.Object) (int, error) {
+	if len(c.constants) >= maxConstants {
+		return 0, c.newError("too many constants, max is %d", maxConstants)
+	}
+
 	c.constants = append(c.constants, obj)
-	return len(c.constants) - 1
+	return len(c.constants) - 1, nil
+}
+
+// defines a binding in the current scope, its index must fit the operand of the instructions
+// that load and store it
+func (c *Compiler) define(name string, constant bool) (Symbol, error) {
+	var symbol Symbol
+	if constant {
+		symbol = c.symbolTable.DefineConst(name)
+	} else {
+		symbol = c.symbolTable.Define(name)
+	}
+
+	switch {
+	case symbol.Scope == GlobalScope && symbol.Index >= maxGlobals:
+		return symbol, c.newError("too many global bindings, max is %d", maxGlobals)
+	case symbol.Scope == LocalScope && symbol.Index >= maxLocals:
+		return symbol, c.newError("too many local bindings in function, max is %d", maxLocals)
+	}
+	return symbol, nil
 }
 
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	instruction := code.Make(op, operands...)
 	position := c.addInstruction(instruction)
+
+	c.setLastInstruction(op, position)
 	return position
 }
 
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// starts compiling a function body, with its own instructions and symbol table
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// finishes the function body and returns its instructions
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+	return instructions
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, position int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: position}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lastInstruction = previous
+	c.truncateSourceMap(last.Position)
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+// replaces the instruction at position, new instruction must have the same width
+func (c *Compiler) replaceInstruction(position int, newInstruction []byte) {
+	copy(c.currentInstructions()[position:], newInstruction)
+}
+
+// function prologue that stores the default value of each parameter whose argument is missing,
+// the vm leaves the local of a missing argument nil. params are the names of the parameters,
+// a default is compiled like in the evaluator, without seeing its parameter and the next ones
+func (c *Compiler) compileDefaults(defaults []ast.Expression, params []string) error {
+	for i, def := range defaults {
+		if def == nil {
+			continue
+		}
+
+		skipPos := c.emit(code.OpSkipDefault, i, 9999)
+
+		restore := c.symbolTable.hide(params[i:]...)
+		err := c.Compile(def)
+		restore()
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpSetLocal, i)
+		c.replaceInstruction(skipPos, code.Make(code.OpSkipDefault, i, len(c.currentInstructions())))
+	}
+	return nil
+}
+
+func (c *Compiler) changeOperand(position int, operand int) {
+	op := code.Opcode(c.currentInstructions()[position])
+	newInstruction := code.Make(op, operand)
+	c.replaceInstruction(position, newInstruction)
+}
+
 func (c *Compiler) addInstruction(i []byte) int {
-	posInstruction := len(c.instructions)
-	c.instructions = slices.Concat(c.instructions, i)
+	posInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), i...)
+
+	entry := code.SourceEntry{Offset: posInstruction, Pos: c.pos}
+	c.scopes[c.scopeIndex].sourceMap = append(c.scopes[c.scopeIndex].sourceMap, entry)
 	return posInstruction
 }
+
+// drops the positions of removed instructions
+func (c *Compiler) truncateSourceMap(offset int) {
+	sm := c.scopes[c.scopeIndex].sourceMap
+	for len(sm) > 0 && sm[len(sm)-1].Offset >= offset {
+		sm = sm[:len(sm)-1]
+	}
+	c.scopes[c.scopeIndex].sourceMap = sm
+}
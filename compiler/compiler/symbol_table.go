@@ -0,0 +1,144 @@
+package compiler
+
+import (
+	"fmt"
+	"maps"
+)
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+	BuiltinScope  SymbolScope = "BUILTIN"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int  // index of the binding in the scope store
+	Const bool // bound with const, assignments are a compile error
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable // enclosing table, nil for the global one
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	FreeSymbols []Symbol // original symbols of the outer scopes captured by this one
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	return &SymbolTable{store: s}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+func (st *SymbolTable) Define(name string) Symbol {
+	// a let that rebinds a name of the same scope reuses its slot, so code compiled before it,
+	// like the condition of a loop, sees the new value
+	if symbol, ok := st.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Index: st.numDefinitions}
+	if st.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	st.store[name] = symbol
+	st.numDefinitions++
+	return symbol
+}
+
+// defines a binding that cant be assigned, see checkDeclaration
+func (st *SymbolTable) DefineConst(name string) Symbol {
+	symbol := st.Define(name)
+	symbol.Const = true
+	st.store[name] = symbol
+	return symbol
+}
+
+func (st *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	st.store[name] = symbol
+	return symbol
+}
+
+// defines the name of the function being compiled, so it can reference itself. only used for
+// const bindings, so the name cannot be assigned
+func (st *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: FunctionScope, Index: 0, Const: true}
+	st.store[name] = symbol
+	return symbol
+}
+
+func (st *SymbolTable) defineFree(original Symbol) Symbol {
+	st.FreeSymbols = append(st.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(st.FreeSymbols) - 1, Const: original.Const}
+	st.store[original.Name] = symbol
+	return symbol
+}
+
+func (st *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := st.store[name]
+	if !ok && st.Outer != nil {
+		symbol, ok = st.Outer.Resolve(name)
+		if !ok || symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+			return symbol, ok
+		}
+
+		// binding of an enclosing function, captured as a free variable
+		return st.defineFree(symbol), true
+	}
+	return symbol, ok
+}
+
+// removes the names from the table until restore is called, meanwhile they resolve in the
+// enclosing scopes. a default value must not see its parameter and the ones after it
+func (st *SymbolTable) hide(names ...string) (restore func()) {
+	hidden := map[string]Symbol{}
+	for _, name := range names {
+		if symbol, ok := st.store[name]; ok {
+			hidden[name] = symbol
+			delete(st.store, name)
+		}
+	}
+
+	return func() { maps.Copy(st.store, hidden) }
+}
+
+// a constant cant be declared again in its scope, not even with let, it would make it
+// assignable. the name of a const function is only a constant inside its body and a captured
+// constant belongs to an outer scope, so both can be shadowed
+func (st *SymbolTable) checkDeclaration(name string) error {
+	symbol, ok := st.store[name]
+	if ok && symbol.Const && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return fmt.Errorf("cannot redeclare constant: %s", name)
+	}
+	return nil
+}
+
+// resolves the target of an assignment, only bindings defined with let can be assigned
+func (st *SymbolTable) ResolveAssignment(name string) (Symbol, error) {
+	symbol, ok := st.Resolve(name)
+
+	switch {
+	case !ok || symbol.Scope == BuiltinScope:
+		return symbol, fmt.Errorf("assignment to undeclared identifier: %s", name)
+	case symbol.Const:
+		return symbol, fmt.Errorf("cannot assign to constant: %s", name)
+	}
+	return symbol, nil
+}
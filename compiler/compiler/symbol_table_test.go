@@ -0,0 +1,258 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+	}
+
+	global := NewSymbolTable()
+
+	a := global.Define("a")
+	if a != expected["a"] {
+		t.Errorf("expected a=%+v, got=%+v", expected["a"], a)
+	}
+
+	b := global.Define("b")
+	if b != expected["b"] {
+		t.Errorf("expected b=%+v, got=%+v", expected["b"], b)
+	}
+}
+
+func TestRedefineReusesIndex(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.Define("b")
+
+	expected := Symbol{Name: "a", Scope: GlobalScope, Index: 0}
+	if a := global.Define("a"); a != expected {
+		t.Errorf("expected a=%+v, got=%+v", expected, a)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	expected = Symbol{Name: "a", Scope: LocalScope, Index: 0}
+	if a := local.Define("a"); a != expected {
+		t.Errorf("expected a=%+v, got=%+v", expected, a)
+	}
+}
+
+func TestConstants(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineConst("a")
+	global.Define("b")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Resolve("a")
+
+	if _, err := local.ResolveAssignment("a"); err == nil || err.Error() != "cannot assign to constant: a" {
+		t.Errorf("expected constant error for a, got=%v", err)
+	}
+
+	if _, err := local.ResolveAssignment("b"); err != nil {
+		t.Errorf("unexpected error for b: %s", err)
+	}
+
+	// a constant cant be declared again in its scope, inner scopes can shadow it
+	if err := global.checkDeclaration("a"); err == nil || err.Error() != "cannot redeclare constant: a" {
+		t.Errorf("expected redeclaration error for a, got=%v", err)
+	}
+
+	if err := global.checkDeclaration("b"); err != nil {
+		t.Errorf("unexpected redeclaration error for b: %s", err)
+	}
+
+	if err := local.checkDeclaration("a"); err != nil {
+		t.Errorf("unexpected redeclaration error for a in the local scope: %s", err)
+	}
+}
+
+func TestResolveGlobal(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.Define("b")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "b", Scope: GlobalScope, Index: 1},
+	}
+
+	for _, sym := range expected {
+		result, ok := global.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+}
+
+func TestResolveNestedLocal(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.Define("b")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+	firstLocal.Define("d")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+	secondLocal.Define("f")
+
+	tests := []struct {
+		table           *SymbolTable
+		expectedSymbols []Symbol
+	}{
+		{
+			firstLocal,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "b", Scope: GlobalScope, Index: 1},
+				{Name: "c", Scope: LocalScope, Index: 0},
+				{Name: "d", Scope: LocalScope, Index: 1},
+			},
+		},
+		{
+			secondLocal,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "b", Scope: GlobalScope, Index: 1},
+				{Name: "e", Scope: LocalScope, Index: 0},
+				{Name: "f", Scope: LocalScope, Index: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, sym := range tt.expectedSymbols {
+			result, ok := tt.table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+	}
+}
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "c", Scope: FreeScope, Index: 0},
+		{Name: "e", Scope: LocalScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := secondLocal.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if len(secondLocal.FreeSymbols) != 1 {
+		t.Fatalf("wrong number of free symbols. got=%d, want=1", len(secondLocal.FreeSymbols))
+	}
+
+	original := Symbol{Name: "c", Scope: LocalScope, Index: 0}
+	if secondLocal.FreeSymbols[0] != original {
+		t.Errorf("wrong free symbol. got=%+v, want=%+v", secondLocal.FreeSymbols[0], original)
+	}
+
+	if _, ok := secondLocal.Resolve("b"); ok {
+		t.Errorf("name b resolved, but was not defined")
+	}
+}
+
+func TestHide(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("b")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("a")
+	local.Define("b")
+
+	restore := local.hide("b")
+
+	result, ok := local.Resolve("b")
+	if !ok || result != (Symbol{Name: "b", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("hidden b should resolve to the global, got=%+v", result)
+	}
+
+	if result, _ := local.Resolve("a"); result != (Symbol{Name: "a", Scope: LocalScope, Index: 0}) {
+		t.Errorf("a should not be hidden, got=%+v", result)
+	}
+
+	restore()
+
+	if result, _ := local.Resolve("b"); result != (Symbol{Name: "b", Scope: LocalScope, Index: 1}) {
+		t.Errorf("restored b should resolve to the local, got=%+v", result)
+	}
+}
+
+func TestDefineAndResolveFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineFunctionName("a")
+
+	expected := Symbol{Name: "a", Scope: FunctionScope, Index: 0, Const: true}
+
+	result, ok := global.Resolve(expected.Name)
+	if !ok {
+		t.Fatalf("function name %s not resolvable", expected.Name)
+	}
+
+	if result != expected {
+		t.Errorf("expected %s to resolve to %+v, got=%+v", expected.Name, expected, result)
+	}
+}
+
+func TestDefineResolveBuiltins(t *testing.T) {
+	global := NewSymbolTable()
+	firstLocal := NewEnclosedSymbolTable(global)
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+
+	expected := []Symbol{
+		{Name: "a", Scope: BuiltinScope, Index: 0},
+		{Name: "c", Scope: BuiltinScope, Index: 1},
+		{Name: "e", Scope: BuiltinScope, Index: 2},
+	}
+
+	for i, v := range expected {
+		global.DefineBuiltin(i, v.Name)
+	}
+
+	for _, table := range []*SymbolTable{global, firstLocal, secondLocal} {
+		for _, sym := range expected {
+			result, ok := table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+	}
+
+	if len(secondLocal.FreeSymbols) != 0 {
+		t.Errorf("builtins were captured as free symbols: %+v", secondLocal.FreeSymbols)
+	}
+}
@@ -0,0 +1,147 @@
+package diagnostic
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"monkey/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	if s == Warning {
+		return "warning"
+	}
+	return "error"
+}
+
+// stable name of the kind of a diagnostic, tools should match on it instead of the message
+type Code string
+
+const (
+	// lexer
+	IllegalCharacter    Code = "illegal-character"
+	InvalidEncoding     Code = "invalid-encoding"
+	MalformedNumber     Code = "malformed-number"
+	InvalidEscape       Code = "invalid-escape"
+	UnterminatedString  Code = "unterminated-string"
+	UnterminatedComment Code = "unterminated-comment"
+
+	// parser
+	UnexpectedToken    Code = "unexpected-token"
+	ExpectedExpression Code = "expected-expression"
+	InvalidNumber      Code = "invalid-number"
+	InvalidAssignment  Code = "invalid-assignment"
+	ConstAssignment    Code = "const-assignment"
+	ConstRedeclaration Code = "const-redeclaration"
+	LoopControl        Code = "loop-control-outside-loop"
+	DuplicateParameter Code = "duplicate-parameter"
+	MissingDefault     Code = "missing-default"
+	TooManyErrors      Code = "too-many-errors"
+)
+
+// suggested edit, Text replaces the source between Start and End. an insertion has Start == End
+type FixIt struct {
+	Message string // like did you mean `)`?
+	Start   token.Position
+	End     token.Position
+	Text    string
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Message  string
+	Start    token.Position
+	End      token.Position // right after the last character
+	FixIts   []FixIt
+}
+
+// pos: message, the format of the string errors. diagnostics without a position only have
+// the message
+func (d Diagnostic) String() string {
+	if !d.Start.IsValid() {
+		return d.Message
+	}
+	return fmt.Sprintf("%s: %s", d.Start, d.Message)
+}
+
+// renders the diagnostic for a terminal, with the source line it starts at and the range
+// underlined:
+//
+//	test.mk:1:15: error: expected next token to be ), got ; instead
+//	    let a = (1 + 2;
+//	                  ^
+//	    did you mean `)`?
+func (d Diagnostic) Render(source string) string {
+	var out strings.Builder
+
+	if d.Start.IsValid() {
+		fmt.Fprintf(&out, "%s: ", d.Start)
+	}
+	fmt.Fprintf(&out, "%s: %s", d.Severity, d.Message)
+
+	if line, ok := sourceLine(source, d.Start); ok {
+		fmt.Fprintf(&out, "\n    %s\n    %s", line, underline(line, d.Start, d.End))
+	}
+
+	for _, fix := range d.FixIts {
+		fmt.Fprintf(&out, "\n    %s", fix.Message)
+	}
+
+	return out.String()
+}
+
+// line of source that contains pos, without the line break
+func sourceLine(source string, pos token.Position) (string, bool) {
+	if !pos.IsValid() || pos.Offset > len(source) {
+		return "", false
+	}
+
+	start := strings.LastIndexByte(source[:pos.Offset], '\n') + 1
+	end := strings.IndexByte(source[pos.Offset:], '\n')
+	if end < 0 {
+		end = len(source)
+	} else {
+		end += pos.Offset
+	}
+
+	return strings.TrimSuffix(source[start:end], "\r"), true
+}
+
+// carets under the columns of line from start to end, a range that goes past the line is
+// underlined up to its end. tabs are kept so the carets line up with the source
+func underline(line string, start, end token.Position) string {
+	var out strings.Builder
+
+	col := 1
+	for _, ch := range line {
+		if col == start.Column {
+			break
+		}
+
+		if ch == '\t' {
+			out.WriteRune('\t')
+		} else {
+			out.WriteRune(' ')
+		}
+		col++
+	}
+
+	width := 1
+	if end.Line > start.Line {
+		width = utf8.RuneCountInString(line) - start.Column + 1
+	} else if end.Line == start.Line && end.Column > start.Column {
+		width = end.Column - start.Column
+	}
+
+	out.WriteString(strings.Repeat("^", max(width, 1)))
+	return out.String()
+}
@@ -0,0 +1,68 @@
+package diagnostic
+
+import (
+	"testing"
+
+	"monkey/token"
+)
+
+func pos(offset, line, column int) token.Position {
+	return token.Position{Filename: "test.mk", Offset: offset, Line: line, Column: column}
+}
+
+func TestString(t *testing.T) {
+	d := Diagnostic{Message: "illegal character '@'", Start: pos(4, 1, 5), End: pos(5, 1, 6)}
+	if d.String() != "test.mk:1:5: illegal character '@'" {
+		t.Errorf("wrong string. got=%q", d.String())
+	}
+
+	d = Diagnostic{Message: "too many errors"}
+	if d.String() != "too many errors" {
+		t.Errorf("wrong string without position. got=%q", d.String())
+	}
+}
+
+func TestRender(t *testing.T) {
+	source := "let a = 1;\n\tlet b = (a + 2;\nb"
+
+	tests := []struct {
+		diagnostic Diagnostic
+		expected   string
+	}{
+		{
+			Diagnostic{
+				Message: "expected next token to be ), got ; instead",
+				Start:   pos(25, 2, 15),
+				End:     pos(26, 2, 16),
+				FixIts:  []FixIt{{Message: "did you mean `)`?", Start: pos(25, 2, 15), End: pos(25, 2, 15), Text: ")"}},
+			},
+			"test.mk:2:15: error: expected next token to be ), got ; instead\n" +
+				"    \tlet b = (a + 2;\n" +
+				"    \t             ^\n" +
+				"    did you mean `)`?",
+		},
+		{
+			Diagnostic{Severity: Warning, Message: "unused", Start: pos(4, 1, 5), End: pos(9, 1, 10)},
+			"test.mk:1:5: warning: unused\n" +
+				"    let a = 1;\n" +
+				"        ^^^^^",
+		},
+		{
+			// ranges spanning lines are underlined up to the end of the first one
+			Diagnostic{Message: "unterminated", Start: pos(8, 1, 9), End: pos(27, 3, 2)},
+			"test.mk:1:9: error: unterminated\n" +
+				"    let a = 1;\n" +
+				"            ^^",
+		},
+		{
+			Diagnostic{Message: "too many errors"},
+			"error: too many errors",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.diagnostic.Render(source); got != tt.expected {
+			t.Errorf("wrong render for %q.\nexpected=\n%s\ngot=\n%s", tt.diagnostic.Message, tt.expected, got)
+		}
+	}
+}
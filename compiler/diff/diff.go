@@ -0,0 +1,232 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/diagnostic"
+	"monkey/eval"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+)
+
+// first place where the results of the evaluator and the vm disagree
+type Divergence struct {
+	Path string // location inside the result, like [1]["key"], empty for the whole result
+	Eval object.Object
+	VM   object.Object
+}
+
+func (d *Divergence) String() string {
+	path := d.Path
+	if path == "" {
+		path = "result"
+	}
+	return fmt.Sprintf("%s differs:\n\teval: %s\n\tvm:   %s", path, inspect(d.Eval), inspect(d.VM))
+}
+
+// parses the input once and runs the program through both the evaluator and the vm,
+// errors from either backend are returned as *object.Error results
+func Run(input string) (object.Object, object.Object, error) {
+	return run(lexer.New(input))
+}
+
+func run(l *lexer.Lexer) (object.Object, object.Object, error) {
+	p := parser.NewParser(l)
+	prog := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		return nil, nil, fmt.Errorf("parser errors: %v", p.Errors())
+	}
+
+	return runEval(prog), runVM(prog), nil
+}
+
+// runs the input through both backends and returns the first divergence, nil if they agree
+func Compare(input string) (*Divergence, error) {
+	evalResult, vmResult, err := Run(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return FirstDivergence(evalResult, vmResult), nil
+}
+
+func runEval(prog *ast.Program) object.Object {
+	return eval.Eval(prog, object.NewEnviroment())
+}
+
+func runVM(prog *ast.Program) object.Object {
+	c := compiler.New()
+	if err := c.Compile(prog); err != nil {
+		return toError(err)
+	}
+
+	machine := vm.New(c.Bytecode())
+	if err := machine.Run(); err != nil {
+		return toError(err)
+	}
+
+	// the evaluator has no value for a trailing let, while the vm last popped the bound value
+	if n := len(prog.Statements); n > 0 {
+		if _, ok := prog.Statements[n-1].(*ast.LetStatement); ok {
+			return vm.Null
+		}
+	}
+
+	return machine.LastPoppedStackElement()
+}
+
+func toError(err error) *object.Error {
+	var errObj *object.Error
+	if errors.As(err, &errObj) {
+		return errObj
+	}
+	return &object.Error{Value: err.Error()}
+}
+
+// structural comparison of an evaluator result with a vm result
+func FirstDivergence(e, v object.Object) *Divergence {
+	return firstDivergence("", e, v)
+}
+
+func firstDivergence(path string, e, v object.Object) *Divergence {
+	e, v = normalize(e), normalize(v)
+	div := &Divergence{Path: path, Eval: e, VM: v}
+
+	// functions can only be compared by kind, each backend has its own representation
+	if isFunction(e) && isFunction(v) {
+		if isBuiltin(e) != isBuiltin(v) || (isBuiltin(e) && e != v) {
+			return div
+		}
+		return nil
+	}
+
+	if e.Type() != v.Type() {
+		return div
+	}
+
+	switch e := e.(type) {
+	case *object.Integer, *object.BigInteger:
+		if object.CompareIntegers(e, v) != 0 {
+			return div
+		}
+	case *object.Float:
+		// NaN is not equal to itself but both backends agree when they both produce it
+		vValue := v.(*object.Float).Value
+		if e.Value != vValue && !(math.IsNaN(e.Value) && math.IsNaN(vValue)) {
+			return div
+		}
+	case *object.Boolean:
+		if e.Value != v.(*object.Boolean).Value {
+			return div
+		}
+	case *object.String:
+		if e.Value != v.(*object.String).Value {
+			return div
+		}
+	case *object.Error:
+		vErr := v.(*object.Error)
+		if e.Value != vErr.Value || e.Pos != vErr.Pos {
+			return div
+		}
+	case *object.Array:
+		vArr := v.(*object.Array)
+		if len(e.Elements) != len(vArr.Elements) {
+			return div
+		}
+
+		for i := range e.Elements {
+			elPath := fmt.Sprintf("%s[%d]", path, i)
+			if d := firstDivergence(elPath, e.Elements[i], vArr.Elements[i]); d != nil {
+				return d
+			}
+		}
+	case *object.Hash:
+		vHash := v.(*object.Hash)
+		if len(e.Pairs) != len(vHash.Pairs) {
+			return div
+		}
+
+		for k, pair := range e.Pairs {
+			vPair, ok := vHash.Pairs[k]
+			if !ok {
+				return div
+			}
+
+			pairPath := fmt.Sprintf("%s[%s]", path, pair.Key.Inspect())
+			if d := firstDivergence(pairPath, pair.Value, vPair.Value); d != nil {
+				return d
+			}
+		}
+	}
+
+	return nil
+}
+
+// the evaluator uses go nil for statements without value, and each backend has its own null
+func normalize(obj object.Object) object.Object {
+	if obj == nil || obj.Type() == object.NULL_OBJ {
+		return eval.NULL
+	}
+	return obj
+}
+
+func isFunction(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Closure, *object.Builtin:
+		return true
+	default:
+		return false
+	}
+}
+
+func isBuiltin(obj object.Object) bool {
+	_, ok := obj.(*object.Builtin)
+	return ok
+}
+
+func inspect(obj object.Object) string {
+	return fmt.Sprintf("%s (%s)", obj.Inspect(), obj.Type())
+}
+
+// runs the file through both backends and prints the result, parser errors and the first
+// divergence are returned so the command fails
+func DiffFile(path string) error {
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	p := parser.NewParser(lexer.NewWithFilename(string(f), path))
+	prog := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		return parserErrors(p.Diagnostics(), string(f))
+	}
+
+	evalResult, vmResult := runEval(prog), runVM(prog)
+	if d := FirstDivergence(evalResult, vmResult); d != nil {
+		return errors.New(d.String())
+	}
+
+	fmt.Printf("eval and vm agree: %s\n", normalize(evalResult).Inspect())
+	return nil
+}
+
+// renders the parser errors against the source like the c and i commands print them
+func parserErrors(diagnostics []diagnostic.Diagnostic, source string) error {
+	var b strings.Builder
+	b.WriteString("Looks like we ran into some monkey business here...\nparser errors:")
+	for _, d := range diagnostics {
+		b.WriteString("\n\t" + strings.ReplaceAll(d.Render(source), "\n", "\n\t"))
+	}
+	return errors.New(b.String())
+}
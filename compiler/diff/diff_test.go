@@ -0,0 +1,268 @@
+package diff
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"monkey/object"
+)
+
+// programs that are known to disagree, with the reason
+var skipped = map[string]string{}
+
+func TestMkCodePrograms(t *testing.T) {
+	files, err := filepath.Glob("../../mk-code/*.mk")
+	if err != nil {
+		t.Fatalf("could not list mk-code programs: %s", err)
+	}
+
+	if len(files) == 0 {
+		t.Fatalf("no mk-code programs found")
+	}
+
+	for _, file := range files {
+		if reason, ok := skipped[filepath.Base(file)]; ok {
+			t.Logf("skipping %s: %s", file, reason)
+			continue
+		}
+
+		input, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("could not read %s: %s", file, err)
+		}
+
+		testNoDivergence(t, file, string(input))
+	}
+}
+
+// small programs covering each language feature, the first ones come from eval_test.go and
+// the later ones check features and fixes added since
+func TestEvalCases(t *testing.T) {
+	inputs := []string{
+		"5",
+		"10 - 5",
+		"5 + 5 + 5 + 5 - 10",
+		"2 * 2 * 2 * 2 * 2",
+		"-50 + 100 + -50",
+		"20 + 2 * -10",
+		"50 / 2 * 2 + 10",
+		"(5 + 10 * 2 + 15 / 3) * 2 + -10",
+		"true",
+		"false",
+		"!true",
+		"!5",
+		"!!false",
+		"!!5",
+		"if(true) {10}",
+		"if(false) {10}",
+		"if(1) {10}",
+		"if(1 < 2) {10}",
+		"if(1 > 2) {10}",
+		"if(1 > 2) {10} else {20}",
+		"if(1 < 2) {10} else {20}",
+		"let a = 3; let b = 5; let x = if (a > b) { a } else { b }; x",
+		"1 + if (true) { 2 } else { 3 }",
+		"[if (true) { 1 }, if (false) { 1 }]",
+		"if (1 + true) { 1 } else { 2 }",
+		"let i = 0; while (i < 10) { let i = i + 1; } i",
+		"let s = 0; for (let i = 0; i < 10; let i = i + 1) { if (i % 2 == 0) { continue; } let s = s + i; } s",
+		"let f = fn(n) { for (let i = 0; ; let i = i + 1) { if (i == n) { return i * 2; } } }; f(4)",
+		"while (1 + true) { }",
+		"for (;;) { break }",
+		"let x = 1; x += 2; x *= 3; x",
+		"let s = 0; for (let i = 0; i < 5; i += 1) { s += i; } s",
+		"let arr = [1, 2, 3]; arr[1] = 20; arr[2] += 10; arr",
+		`let h = {"a": 1}; h["b"] = 2; h["a"] += 5; h`,
+		"let counter = fn() { let c = 0; fn() { c += 1 } }; let next = counter(); next(); next(); next()",
+		"let f = fn() { let x = 1; let g = fn() { x }; x = 3; g() }; f()",
+		"y = 1",
+		"let a = [1]; a[1] = 2",
+		"const x = 1; let f = fn(x) { x = 2; x }; f(5) + x",
+		"const a = [1]; a[0] = 2; a",
+		"const x = 1; let f = fn() { let x = 2; x = 3; x }; f() + x",
+		"let i = 0; while (i < 3) { const x = i; i += 1; } i",
+		"5+true;",
+		"5 + true; 5;",
+		"-true;",
+		"true + false;",
+		"5; true + false; 5",
+		"if (10 > 1) { true + false; }",
+		"foobar",
+		`"Hello" - "World"`,
+		`{"name": "Monkey"}[fn(x) { x }];`,
+		"return 10;",
+		"return 10; 9;",
+		"9; return 2 * 5; 9;",
+		"let a = 5; a;",
+		"let a = 5; let b = a; let c = a + b + 5; c;",
+		"fn(x) { x + 2; };",
+		"let identity = fn(x) { x; }; identity(5);",
+		"let identity = fn(x) { return x; }; identity(5);",
+		"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));",
+		"fn(x) { x; }(5)",
+		`"Hello World!"`,
+		`"Hello" + " " + "World!"`,
+		`len("")`,
+		`len("hello world")`,
+		`len(1)`,
+		`len("one", "two")`,
+		`count("abca", "a")`,
+		`count("abca")`,
+		`first([1, 2])`,
+		`first([])`,
+		`tail([])`,
+		"[1, 2 * 2, 3 + 3]",
+		"[1, 2, 3][0]",
+		"let i = 0; [1][i];",
+		"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
+		"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+		"[1, 2, 3][3]",
+		"[1, 2, 3][-1]",
+		`let two = "two"; {"one": 10 - 9, two: 1 + 1, "thr" + "ee": 6 / 2, 4: 4, true: 5, false: 6}`,
+		`{"foo": 5}["foo"]`,
+		`{"foo": 5}["bar"]`,
+		`let key = "foo"; {"foo": 5}[key]`,
+		`{}["foo"]`,
+		`{5: 5}[5]`,
+		`{true: 5}[true]`,
+		"let a = 1;",
+		"",
+		"1.5 + 2",
+		"7 / 2.0",
+		"1 < 1.5",
+		"-2.5 * 2",
+		"1.5 + true",
+		`{1: "one"}[1.0]`,
+		`int(3.9) + float("0.5")`,
+		"9223372036854775807 + 1",
+		"(9223372036854775807 + 1) - 1",
+		"let f = fn(n) { if (n == 0) { 1 } else { n * f(n - 1) } }; f(25)",
+		"{9223372036854775807 * 2: 1}[18446744073709551614.0]",
+		"1 <= 2 && 2 >= 3",
+		"false || 1 < 2",
+		"false && 1 + true",
+		"true && 1 + true",
+		"7 % 3 + (6 & 3) + (6 | 3) + (6 ^ 3)",
+		"(1 << 70) >> 69",
+		"1 / 0",
+		"let f = fn(x) { 10 % x }; f(0)",
+		`let café = "héllo"; [len(café), café[1], café[9]]`,
+		"len",
+		"let g = fn() { let f = fn() { f = 1 }; f(); f }; g()",
+		"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; let g = f; f = fn(n) { 99 }; g(3)",
+		"let g = fn() { let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; let h = f; f = fn(n) { 99 }; h(3) }; g()",
+		"let s = 0; for (let i = 0; i < 5000; i += 1) { s = s + 1 + if (i % 2 == 0) { continue; } else { 0 }; } s",
+		"let n = 0; while (true) { n += 1; let x = [n, if (n == 3000) { break; } else { 1 }]; } n",
+		"[9223372036854775808, -9223372036854775808, 0xFFFFFFFFFFFFFFFF, 9223372036854775808 - 1]",
+		"let l = []; let a = fn(x) { l = push(l, x); x }; [a(1) < a(2), a(4) < a(3), l]",
+		`"a" < "b"`,
+		`1 < "a"`,
+		"let l = []; let a = fn(x) { l = push(l, x); x }; [a(1) <= a(2), a(4) <= a(3), l]",
+		"true <= false",
+		`"a" <= 1`,
+		"let f = fn(a, b = a * 10, c = b + 1) { [a, b, c] }; [f(1), f(1, 2), f(1, 2, 3)]",
+		"let f = fn(first, ...rest) { [first, rest] }; [f(1), f(1, 2, 3)]",
+		"let f = fn(a, b, c) { a + b + c }; let xs = [1, 2]; [f(...xs, 3), f(0, ...[5, 6])]",
+		"let f = fn(a, b) { a }; f(1)",
+		"let f = fn(a, ...b) { a }; f(...[])",
+		"push(...[[1], 2])",
+		"let depth = fn(x) { if (x == 0) { 0 } else { 1 + depth(x - 1) } }; depth(1000)",
+		"let f = fn() { const a = 1; let g = fn() { let x = a; let a = 2; a }; g() }; f()",
+	}
+
+	for _, input := range inputs {
+		testNoDivergence(t, input, input)
+	}
+}
+
+func TestFirstDivergence(t *testing.T) {
+	tests := []struct {
+		eval         object.Object
+		vm           object.Object
+		expectedPath string
+		diverges     bool
+	}{
+		{&object.Integer{Value: 1}, &object.Integer{Value: 1}, "", false},
+		{&object.Integer{Value: 1}, &object.Integer{Value: 2}, "", true},
+		{&object.Integer{Value: 1}, &object.String{Value: "1"}, "", true},
+		{nil, &object.Null{}, "", false},
+		{&object.Error{Value: "a"}, &object.Error{Value: "b"}, "", true},
+		{
+			&object.Array{Elements: []object.Object{&object.Integer{Value: 1}, &object.Integer{Value: 2}}},
+			&object.Array{Elements: []object.Object{&object.Integer{Value: 1}, &object.Integer{Value: 3}}},
+			"[1]",
+			true,
+		},
+		{
+			&object.Array{Elements: []object.Object{&object.Integer{Value: 1}}},
+			&object.Array{Elements: []object.Object{}},
+			"",
+			true,
+		},
+		{
+			hash("key", &object.Array{Elements: []object.Object{&object.Boolean{Value: true}}}),
+			hash("key", &object.Array{Elements: []object.Object{&object.Boolean{Value: false}}}),
+			"[key][0]",
+			true,
+		},
+		{&object.Function{}, &object.Closure{}, "", false},
+		{&object.Function{}, object.GetBuiltinByName("len"), "", true},
+	}
+
+	for i, tt := range tests {
+		d := FirstDivergence(tt.eval, tt.vm)
+		if !tt.diverges {
+			if d != nil {
+				t.Errorf("tests[%d] - unexpected divergence: %s", i, d)
+			}
+			continue
+		}
+
+		if d == nil {
+			t.Errorf("tests[%d] - expected divergence, got none", i)
+			continue
+		}
+
+		if d.Path != tt.expectedPath {
+			t.Errorf("tests[%d] - wrong divergence path. want=%q, got=%q", i, tt.expectedPath, d.Path)
+		}
+	}
+}
+
+func TestDiffFileParserErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.mk")
+	if err := os.WriteFile(path, []byte("let = 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// rendered like the c and i commands print them, instead of the list of messages
+	expected := "parser errors:\n\t" + path + ":1:5: error: expected next token to be IDENT, got = instead"
+
+	err := DiffFile(path)
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("wrong error, got %v, want it to contain %q", err, expected)
+	}
+}
+
+func hash(key string, value object.Object) *object.Hash {
+	k := &object.String{Value: key}
+	return &object.Hash{Pairs: map[object.HashKey]object.HashPair{
+		k.HashKey(): {Key: k, Value: value},
+	}}
+}
+
+func testNoDivergence(t *testing.T, name, input string) {
+	t.Helper()
+
+	d, err := Compare(input)
+	if err != nil {
+		t.Errorf("%s: %s", name, err)
+		return
+	}
+
+	if d != nil {
+		t.Errorf("%s: eval and vm disagree, %s", name, d)
+	}
+}
@@ -2,135 +2,55 @@ package eval
 
 import (
 	"fmt"
+	"math"
 	"strings"
 
 	"monkey/ast"
 	"monkey/object"
 )
 
-var builtins = map[string]*object.Builtin{
-	"len": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			switch arg := args[0].(type) {
-			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
-			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
-			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
-			}
-		},
-	},
-	"count": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2", len(args))
-			}
-
-			switch arg := args[0].(type) {
-			case *object.String:
-				if substr, ok := args[1].(*object.String); ok {
-					return &object.Integer{Value: int64(strings.Count(arg.Value, substr.Value))}
-				} else {
-					return newError("argument 1 to `count` not supported, got %s", args[1].Type())
-				}
-			default:
-				return newError("argument 0 to `count` not supported, got %s", args[0].Type())
-			}
-		},
-	},
-	"first": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
-			}
-
-			a := args[0].(*object.Array)
-			if len(a.Elements) > 0 {
-				return a.Elements[0]
-			}
-			return NULL
-		},
-	},
-	"last": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
-			}
-
-			a := args[0].(*object.Array)
-			if len(a.Elements) > 0 {
-				return a.Elements[len(a.Elements)-1]
-			}
-			return NULL
-		},
-	},
-	"tail": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `tail` must be ARRAY, got %s", args[0].Type())
-			}
-
-			a := args[0].(*object.Array)
-			if len(a.Elements) > 0 {
-				newElements := make([]object.Object, (len(a.Elements) - 1), (len(a.Elements) - 1))
-				copy(newElements, a.Elements[1:(len(a.Elements))])
-				return &object.Array{Elements: newElements}
-			}
-			return NULL
-		},
-	},
-	"push": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2", len(args))
-			}
-
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
-			}
-
-			a := args[0].(*object.Array)
-			newElements := make([]object.Object, (len(a.Elements) + 1), (len(a.Elements) + 1))
-			copy(newElements, a.Elements)
-			newElements[len(a.Elements)] = args[1]
-			return &object.Array{Elements: newElements}
-		},
-	},
-}
-
 var (
 	TRUE       = &object.Boolean{Value: true}
 	FALSE      = &object.Boolean{Value: false}
 	NULL       = &object.Null{}
-	OPERATIONS = map[string]func(int64, int64) int64{
-		"+": func(a, b int64) int64 { return a + b },
-		"-": func(a, b int64) int64 { return a - b },
-		"*": func(a, b int64) int64 { return a * b },
-		"/": func(a, b int64) int64 { return a / b },
+	BREAK      = &object.Break{}
+	CONTINUE   = &object.Continue{}
+	OPERATIONS = map[string]func(object.Object, object.Object) object.Object{
+		"+":  object.AddIntegers,
+		"-":  object.SubIntegers,
+		"*":  object.MulIntegers,
+		"/":  object.DivIntegers,
+		"%":  object.ModIntegers,
+		"&":  object.AndIntegers,
+		"|":  object.OrIntegers,
+		"^":  object.XorIntegers,
+		"<<": object.ShiftLeftIntegers,
+		">>": object.ShiftRightIntegers,
 	}
+	// applied to the result of object.CompareIntegers and 0
 	BOOLOPERATIONS = map[string]func(int64, int64) bool{
 		">":  func(a, b int64) bool { return a > b },
 		"<":  func(a, b int64) bool { return a < b },
+		">=": func(a, b int64) bool { return a >= b },
+		"<=": func(a, b int64) bool { return a <= b },
 		"!=": func(a, b int64) bool { return a != b },
 		"==": func(a, b int64) bool { return a == b },
 	}
+	FLOATOPERATIONS = map[string]func(float64, float64) float64{
+		"+": func(a, b float64) float64 { return a + b },
+		"-": func(a, b float64) float64 { return a - b },
+		"*": func(a, b float64) float64 { return a * b },
+		"/": func(a, b float64) float64 { return a / b },
+		"%": math.Mod,
+	}
+	FLOATBOOLOPERATIONS = map[string]func(float64, float64) bool{
+		">":  func(a, b float64) bool { return a > b },
+		"<":  func(a, b float64) bool { return a < b },
+		">=": func(a, b float64) bool { return a >= b },
+		"<=": func(a, b float64) bool { return a <= b },
+		"!=": func(a, b float64) bool { return a != b },
+		"==": func(a, b float64) bool { return a == b },
+	}
 	STRCOMPOPERATIONS = map[string]func(string, string) bool{
 		"!=": func(a, b string) bool { return a != b },
 		"==": func(a, b string) bool { return a == b },
@@ -138,6 +58,17 @@ var (
 )
 
 func Eval(node ast.Node, env *object.Enviroment) object.Object {
+	result := evalNode(node, env)
+
+	// errors take the position of the innermost node that produced them
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+func evalNode(node ast.Node, env *object.Enviroment) object.Object {
 	switch node := node.(type) {
 	// statements
 	case *ast.Program:
@@ -151,63 +82,116 @@ func Eval(node ast.Node, env *object.Enviroment) object.Object {
 
 	case *ast.ReturnStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.Return{Value: val}
 
 	case *ast.LetStatement:
+		// declaring a constant again, even with let, would make it assignable
+		if env.Redeclares(node.Name.Value, node) {
+			return newError("cannot redeclare constant: %s", node.Name.Value)
+		}
+
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
-		env.Add(node.Name.Value, val)
+		if node.Const {
+			env.AddConst(node.Name.Value, val, node)
+		} else {
+			env.Add(node.Name.Value, val)
+		}
 
 		// expressions
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 	case *ast.IfStatement:
-		return evalIfStatement(node, env)
+		return evalIf(node.Condition, node.Consequence, node.Alternative, env)
+	case *ast.IfExpression:
+		return evalIf(node.Condition, node.Consequence, node.Alternative, env)
+	case *ast.WhileStatement:
+		return evalLoop(nil, node.Condition, nil, node.Body, env)
+	case *ast.ForStatement:
+		return evalLoop(node.Init, node.Condition, node.Post, node.Body, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
+
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(left, node, env)
+		}
+
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalInfixExpression(left, node.Operator, right)
 
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
-		if isError(function) {
+		if isAbrupt(function) {
 			return function
 		}
 		args := evalExpressions(node.Arguments, env)
 
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		result := applyFunction(function, args)
+
+		// builds the call stack while the error propagates out of user functions
+		if err, ok := result.(*object.Error); ok {
+			if fn, ok := function.(*object.Function); ok {
+				err.Stack = append(err.Stack, object.CallSite{Function: fn.Name, Pos: node.Pos()})
+			}
+		}
+
+		return result
 
 	case *ast.FunctionLiteral:
 		params := node.Arguments
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{Parameters: params, Defaults: node.Defaults, Rest: node.Rest, Body: body, Env: env, Name: node.Name}
+
+	case *ast.SpreadExpression:
+		// evalExpressions passes the elements as separate arguments
+		value := Eval(node.Value, env)
+		if isAbrupt(value) {
+			return value
+		}
+
+		if value.Type() != object.ARRAY_OBJ {
+			return newError("spread operator not supported: %s", value.Type())
+		}
+		return value
 
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInteger{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.Boolean:
 		return nativeBoolToObj(node.Value)
 
@@ -216,19 +200,19 @@ func Eval(node ast.Node, env *object.Enviroment) object.Object {
 
 	case *ast.ArrayLiteral:
 		e := evalExpressions(node.Elements, env)
-		if len(e) == 1 && isError(e[0]) {
+		if len(e) == 1 && isAbrupt(e[0]) {
 			return e[0]
 		}
 		return &object.Array{Elements: e}
 
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
 
 		i := Eval(node.Index, env)
-		if isError(i) {
+		if isAbrupt(i) {
 			return i
 		}
 		return evalIndexExpression(left, i)
@@ -263,11 +247,9 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Enviroment) objec
 	for _, st := range block.Statements {
 		result = Eval(st, env)
 
-		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-				return result
-			}
+		// returns, errors, break and continue are handled by whoever runs the block
+		if isAbrupt(result) {
+			return result
 		}
 	}
 
@@ -279,7 +261,7 @@ func evalIdentifier(node *ast.Identifier, env *object.Enviroment) object.Object
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
 		return builtin
 	}
 
@@ -291,10 +273,15 @@ func evalExpressions(expressions []ast.Expression, env *object.Enviroment) []obj
 
 	for _, e := range expressions {
 		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
-		res = append(res, evaluated)
+
+		if _, ok := e.(*ast.SpreadExpression); ok {
+			res = append(res, evaluated.(*object.Array).Elements...)
+		} else {
+			res = append(res, evaluated)
+		}
 	}
 	return res
 }
@@ -302,22 +289,53 @@ func evalExpressions(expressions []ast.Expression, env *object.Enviroment) []obj
 func applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendedFunctionEnv(fn, args)
+		if err := object.CheckArity(len(args), fn.Required(), len(fn.Parameters), fn.Rest != nil); err != nil {
+			return err
+		}
+
+		extendedEnv, abrupt := extendedFunctionEnv(fn, args)
+		if abrupt != nil {
+			return unwrapedReturnValue(abrupt)
+		}
+
 		evaluated := Eval(fn.Body, extendedEnv)
 		return unwrapedReturnValue(evaluated)
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if result := fn.Fn(args...); result != nil {
+			return result
+		}
+		return NULL
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
-func extendedFunctionEnv(fn *object.Function, args []object.Object) *object.Enviroment {
+// binds the arguments, which must already match the arity of fn. missing arguments take their
+// default value, evaluated in the new enviroment so it sees the parameters before it. an error
+// or return in a default is returned instead of the enviroment
+func extendedFunctionEnv(fn *object.Function, args []object.Object) (*object.Enviroment, object.Object) {
 	env := object.NewEnclosedEnviroment(fn.Env)
 	for idx, param := range fn.Parameters {
-		env.Add(param.Value, args[idx])
+		if idx < len(args) {
+			env.Add(param.Value, args[idx])
+			continue
+		}
+
+		value := Eval(fn.Defaults[idx], env)
+		if isAbrupt(value) {
+			return nil, value
+		}
+		env.Add(param.Value, value)
 	}
-	return env
+
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.Add(fn.Rest.Value, &object.Array{Elements: rest})
+	}
+	return env, nil
 }
 
 func unwrapedReturnValue(obj object.Object) object.Object {
@@ -342,6 +360,9 @@ func evalInfixExpression(left object.Object, operator string, right object.Objec
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(left, operator, right)
+	case isNumber(left) && isNumber(right):
+		// at least one side is a float, the integer side is converted
+		return evalFloatInfixExpression(left, operator, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(left, operator, right)
 	case operator == "==":
@@ -355,6 +376,22 @@ func evalInfixExpression(left object.Object, operator string, right object.Objec
 	}
 }
 
+// the right side is only evaluated when the left side doesnt decide the result
+func evalLogicalExpression(left object.Object, node *ast.InfixExpression, env *object.Enviroment) object.Object {
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+
+	right := Eval(node.Right, env)
+	if isAbrupt(right) {
+		return right
+	}
+	return nativeBoolToObj(isTruthy(right))
+}
+
 func evalBangOperatorExpression(right object.Object) object.Object {
 	switch right {
 	case TRUE:
@@ -369,11 +406,21 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalIntegerInfixExpression(left object.Object, operator string, right object.Object) object.Object {
-	valueLeft := left.(*object.Integer).Value
-	valueRight := right.(*object.Integer).Value
 	if fn, ok := OPERATIONS[operator]; ok {
-		return &object.Integer{Value: fn(valueLeft, valueRight)}
+		return fn(left, right)
 	} else if fn, ok := BOOLOPERATIONS[operator]; ok {
+		return nativeBoolToObj(fn(int64(object.CompareIntegers(left, right)), 0))
+	}
+
+	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+func evalFloatInfixExpression(left object.Object, operator string, right object.Object) object.Object {
+	valueLeft := toFloat(left)
+	valueRight := toFloat(right)
+	if fn, ok := FLOATOPERATIONS[operator]; ok {
+		return &object.Float{Value: fn(valueLeft, valueRight)}
+	} else if fn, ok := FLOATBOOLOPERATIONS[operator]; ok {
 		return nativeBoolToObj(fn(valueLeft, valueRight))
 	}
 
@@ -393,30 +440,144 @@ func evalStringInfixExpression(left object.Object, operator string, right object
 }
 
 func evalMinusOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer, *object.BigInteger:
+		return object.NegateInteger(right)
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
+}
+
+// the target is evaluated before the value, like in the vm
+func evalAssignExpression(node *ast.AssignExpression, env *object.Enviroment) object.Object {
+	// compound assignments apply the operator without the =
+	operator := strings.TrimSuffix(node.Operator, "=")
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		current, ok := env.Value(target.Value)
+		if !ok {
+			return newError("assignment to undeclared identifier: %s", target.Value)
+		}
+
+		if env.IsConst(target.Value) {
+			return newError("cannot assign to constant: %s", target.Value)
+		}
+
+		val := evalAssignedValue(current, operator, node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+
+		env.Assign(target.Value, val)
+		return val
 
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+
+		index := Eval(target.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+
+		var current object.Object
+		if operator != "" {
+			current = evalIndexExpression(left, index)
+			if isAbrupt(current) {
+				return current
+			}
+		}
+
+		val := evalAssignedValue(current, operator, node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+
+		if err := object.SetIndex(left, index, val); err != nil {
+			return err
+		}
+		return val
+
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
 }
 
-func evalIfStatement(node *ast.IfStatement, env *object.Enviroment) object.Object {
-	condition := Eval(node.Condition, env)
+// value of the right side, combined with the current value for compound assignments
+func evalAssignedValue(current object.Object, operator string, value ast.Expression, env *object.Enviroment) object.Object {
+	val := Eval(value, env)
+	if isAbrupt(val) || operator == "" {
+		return val
+	}
+
+	return evalInfixExpression(current, operator, val)
+}
+
+// shared by the statement and the expression form of if
+func evalIf(cond ast.Expression, consequence, alternative *ast.BlockStatement, env *object.Enviroment) object.Object {
+	condition := Eval(cond, env)
+	if isAbrupt(condition) {
+		return condition
+	}
 
 	if isTruthy(condition) {
-		return Eval(node.Consequence, env)
-	} else if node.Alternative != nil {
-		return Eval(node.Alternative, env)
+		return Eval(consequence, env)
+	} else if alternative != nil {
+		return Eval(alternative, env)
 	} else {
 		return NULL
 	}
 }
 
+// loops are statements that evaluate to null, init, condition and post are optional
+func evalLoop(init ast.Statement, cond ast.Expression, post ast.Statement, body *ast.BlockStatement, env *object.Enviroment) object.Object {
+	if init != nil {
+		if result := Eval(init, env); isAbrupt(result) {
+			return result
+		}
+	}
+
+	for {
+		if cond != nil {
+			condition := Eval(cond, env)
+			if isAbrupt(condition) {
+				return condition
+			}
+
+			if !isTruthy(condition) {
+				return NULL
+			}
+		}
+
+		result := Eval(body, env)
+		if result != nil {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+				return result
+			case object.BREAK_OBJ:
+				return NULL
+			}
+		}
+
+		if post != nil {
+			if result := Eval(post, env); isAbrupt(result) {
+				return result
+			}
+		}
+	}
+}
+
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -426,7 +587,12 @@ func evalIndexExpression(left, index object.Object) object.Object {
 
 func evalArrayIndexExpression(arr, index object.Object) object.Object {
 	a := arr.(*object.Array)
-	i := index.(*object.Integer).Value
+	idx, ok := index.(*object.Integer)
+	if !ok {
+		// big integers are always out of range
+		return NULL
+	}
+	i := idx.Value
 
 	maxIndex := int64(len(a.Elements) - 1)
 	if i < 0 || i > maxIndex {
@@ -436,12 +602,23 @@ func evalArrayIndexExpression(arr, index object.Object) object.Object {
 	return a.Elements[i]
 }
 
+// strings are indexed by character, not by byte
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	runes := []rune(str.(*object.String).Value)
+	idx, ok := index.(*object.Integer)
+	if !ok || idx.Value < 0 || idx.Value >= int64(len(runes)) {
+		return NULL
+	}
+
+	return &object.String{Value: string(runes[idx.Value])}
+}
+
 func evalHashLiteral(node *ast.HashLiteral, env *object.Enviroment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
 	for k, v := range node.Pairs {
 		key := Eval(k, env)
-		if isError(key) {
+		if isAbrupt(key) {
 			return nil
 		}
 
@@ -451,7 +628,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Enviroment) object.Objec
 		}
 
 		value := Eval(v, env)
-		if isError(value) {
+		if isAbrupt(value) {
 			return nil
 		}
 
@@ -476,6 +653,18 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	return pair.Value
 }
 
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// value of an integer or float as a float
+func toFloat(obj object.Object) float64 {
+	if f, ok := obj.(*object.Float); ok {
+		return f.Value
+	}
+	return object.IntegerToFloat(obj)
+}
+
 func nativeBoolToObj(b bool) *object.Boolean {
 	if b {
 		return TRUE
@@ -500,9 +689,14 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Value: fmt.Sprintf(format, a...)}
 }
 
-func isError(obj object.Object) bool {
+// errors and the control flow objects stop the evaluation of the enclosing expressions, they are
+// passed up until a function call, a loop or the program handles them
+func isAbrupt(obj object.Object) bool {
 	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+		switch obj.Type() {
+		case object.ERROR_OBJ, object.RETURN_VALUE_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+			return true
+		}
 	}
 	return false
 }
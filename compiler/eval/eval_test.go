@@ -1,6 +1,7 @@
 package eval
 
 import (
+	"math"
 	"slices"
 	"testing"
 
@@ -28,6 +29,16 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+		{"1 + 2 << 1", 5},
+		{"2 * 3 % 4", 2},
+		{"(1 << 70) >> 69", 2},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -56,6 +67,108 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func TestEvalBigIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"let f = fn(n) { if (n == 0) { 1 } else { n * f(n - 1) } }; f(25)", "15511210043330985984000000"},
+		{"(9223372036854775807 + 1) - 1", "9223372036854775807"},
+		{"(9223372036854775807 * 3) / 3", "9223372036854775807"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{`int("123456789012345678901234567890")`, "123456789012345678901234567890"},
+		{"9223372036854775808", "9223372036854775808"},
+		{"0xFFFFFFFFFFFFFFFF", "18446744073709551615"},
+		{"-9223372036854775808 - 1", "-9223372036854775809"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Type() != object.INTEGER_OBJ || evaluated.Inspect() != tt.expected {
+			t.Errorf("%s - wrong integer. expected=%s, got=%s (%T)", tt.input, tt.expected, evaluated.Inspect(), evaluated)
+		}
+	}
+
+	// values that fit are demoted back so they keep working as array indexes
+	testIntegerObject(t, testEval("(9223372036854775807 + 1) - 1"), 9223372036854775807)
+	testIntegerObject(t, testEval("-9223372036854775808"), math.MinInt64)
+	testIntegerObject(t, testEval("[1, 2][(9223372036854775807 + 1) - 9223372036854775807]"), 2)
+	testBooleanObject(t, testEval("9223372036854775807 * 2 > 9223372036854775807"), true)
+	testBooleanObject(t, testEval("9223372036854775807 * 2 == 9223372036854775807 + 9223372036854775807"), true)
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	testIntegerObject(t, testEval("let x1 = 5; let café = x1 * 2; let 名前 = café + 1; 名前"), 11)
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"-2.5", -2.5},
+		{"1.5 + 2", 3.5},
+		{"2 * 1.5", 3},
+		{"7 / 2.0", 3.5},
+		{"1e3 - 1", 999},
+		{"0.5 * (2 + 3.0)", 2.5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func TestLogicalExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 2", false},
+		{"2.5 >= 2", true},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && \"\"", true},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		// the right side is not evaluated, so the missing identifier is never looked up
+		{"false && missing", false},
+		{"true || missing", true},
+		{"false && 1 + true", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+
+	errObj, ok := testEval("true && missing").(*object.Error)
+	if !ok || errObj.Value != "identifier not found: missing" {
+		t.Errorf("expected error from the right side, got=%+v", errObj)
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -63,6 +176,10 @@ func TestBooleanExpression(t *testing.T) {
 	}{
 		{"true", true},
 		{"false", false},
+		{"1 < 1.5", true},
+		{"2.5 > 3", false},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 != 0.3", true},
 	}
 
 	for _, tt := range tests {
@@ -106,6 +223,32 @@ func TestBangOperator(t *testing.T) {
 	}
 }
 
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 10) { let i = i + 1; } i", 10},
+		{"while (false) { 10 }", nil},
+		{"let i = 0; while (true) { if (i == 5) { break; } let i = i + 1; } i", 5},
+		{"let s = 0; for (let i = 0; i < 10; let i = i + 1) { if (i % 2 == 0) { continue; } let s = s + i; } s", 25},
+		{"let s = 0; for (let i = 0; i < 3; let i = i + 1) { for (let j = 0; j < 3; let j = j + 1) { if (j == 1) { break; } let s = s + 1; } } s", 3},
+		{"let f = fn(n) { for (let i = 0; ; let i = i + 1) { if (i == n) { return i * 2; } } }; f(4)", 8},
+		{"let i = 0; while (i < 3) { let i = i + 1; 1 + if (true) { continue; } } i", 3},
+		{"let i = 0; while (i < 300000) { let i = i + 1; } i", 300000},
+	}
+
+	for tt := range slices.Values(tests) {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -118,6 +261,10 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if(1 > 2) {10}", nil},
 		{"if(1 > 2) {10} else {20}", 20},
 		{"if(1 < 2) {10} else {20}", 10},
+		{"let a = 3; let b = 5; let x = if (a > b) { a } else { b }; x", 5},
+		{"1 + if (true) { 2 } else { 3 }", 3},
+		{"let x = if (false) { 10 }; x", nil},
+		{"let f = fn(n) { let r = if (n > 0) { return 10 } else { 20 }; r + 1 }; f(1)", 10},
 	}
 
 	for tt := range slices.Values(tests) {
@@ -180,6 +327,62 @@ func TestErrorHandling(t *testing.T) {
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			"1 / 0",
+			"division by zero",
+		},
+		{
+			"let x = 0; 10 % x",
+			"division by zero",
+		},
+		{
+			"1 << -1",
+			"negative shift count: -1",
+		},
+		{
+			"1.5 & 1",
+			"unknown operator: FLOAT & INTEGER",
+		},
+		{
+			"y = 1",
+			"assignment to undeclared identifier: y",
+		},
+		{
+			"let a = [1]; a[1] = 2",
+			"index out of range: 1",
+		},
+		{
+			"const x = 1; x = 2",
+			"cannot assign to constant: x",
+		},
+		{
+			"const x = 1; let f = fn() { x += 1 }; f()",
+			"cannot assign to constant: x",
+		},
+		{
+			"const x = 1; let x = 2;",
+			"cannot redeclare constant: x",
+		},
+		{
+			`let s = "abc"; s[0] = "x"`,
+			"index assignment not supported: STRING",
+		},
+		{
+			"fn(a, b) { a }(1)",
+			"wrong number of arguments. got=1, want=2",
+		},
+		{
+			"fn(a, b = 2) { a }()",
+			"wrong number of arguments. got=0, want=1..2",
+		},
+		{
+			"fn(a, ...rest) { a }()",
+			"wrong number of arguments. got=0, want>=1",
+		},
+		{
+			"fn(a) { a }(...1)",
+			"spread operator not supported: INTEGER",
+		},
 	}
 
 	for tt := range slices.Values(tests) {
@@ -199,6 +402,79 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 +\n  true", "1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn(a) {\n  a + 1;\n};\nf(true);", "2:5: type mismatch: BOOLEAN + INTEGER"},
+		{"let a = 1;\n  foobar", "2:3: identifier not found: foobar"},
+		{"len(1,\n 2)", "1:4: wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errObj.Error())
+		}
+	}
+}
+
+func TestErrorCallStack(t *testing.T) {
+	input := `let inner = fn(x) {
+  x + true
+};
+let outer = fn(y) { inner(y) };
+outer(1);`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	expected := []struct {
+		function string
+		pos      string
+	}{
+		{"inner", "4:26"},
+		{"outer", "5:6"},
+	}
+
+	if len(errObj.Stack) != len(expected) {
+		t.Fatalf("wrong stack length. want=%d, got=%d", len(expected), len(errObj.Stack))
+	}
+
+	for i, call := range expected {
+		if errObj.Stack[i].Function != call.function {
+			t.Errorf("stack[%d] wrong function. want=%q, got=%q", i, call.function, errObj.Stack[i].Function)
+		}
+		if errObj.Stack[i].Pos.String() != call.pos {
+			t.Errorf("stack[%d] wrong position. want=%q, got=%q", i, call.pos, errObj.Stack[i].Pos)
+		}
+	}
+
+	traceback := "ERROR: 2:5: type mismatch: INTEGER + BOOLEAN\n" +
+		"\tin inner, called at 4:26\n" +
+		"\tin outer, called at 5:6"
+	if errObj.Traceback() != traceback {
+		t.Errorf("wrong traceback. want=%q, got=%q", traceback, errObj.Traceback())
+	}
+
+	// builtin errors are positioned at the call and add no frame
+	evaluated = testEval("len(1)")
+	if errObj, ok := evaluated.(*object.Error); !ok || len(errObj.Stack) != 0 {
+		t.Errorf("expected error without call stack. got=%+v", evaluated)
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -231,6 +507,31 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; x = x + 1; x", 2},
+		{"let x = 1; x += 2; x *= 3; x -= 1; x /= 2; x", 4},
+		{"let a = 1; let b = 2; a = b = 5; a + b", 10},
+		{"let x = 1; x = 5", 5},
+		{"let s = 0; for (let i = 0; i < 5; i += 1) { s += i; } s", 10},
+		{"let arr = [1, 2, 3]; arr[1] = 20; arr[2] += 10; arr[1] + arr[2]", 33},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] += 5; h["a"] * h["b"]`, 12},
+		{"let x = 1; let f = fn() { x = 10; }; f(); x", 10},
+		{"let x = 1; let f = fn() { let x = 2; x = 20; }; f(); x", 1},
+		{"let counter = fn() { let c = 0; fn() { c += 1 } }; let next = counter(); next(); next(); next()", 3},
+		{"const x = 1; let f = fn(x) { x = 5; x }; f(1) + x", 6},
+		{"const x = 1; let f = fn() { let x = 2; x = 3; x }; f() + x", 4},
+		{"const a = [1]; a[0] = 7; a[0]", 7},
+	}
+
+	for tt := range slices.Values(tests) {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 	evaluated := testEval(input)
@@ -268,6 +569,28 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let add = fn(x, y = 10) { x + y }; add(5);", 15},
+		{"let add = fn(x, y = 10) { x + y }; add(5, 1);", 6},
+		{"let f = fn(x, y = x * 2, z = y + 1) { x + y + z }; f(1);", 6},
+		{"let y = 100; let f = fn(x, y = y) { x + y }; f(1);", 101},
+		{"let count = fn(...rest) { len(rest) }; count();", 0},
+		{"let count = fn(x, ...rest) { len(rest) }; count(1, 2, 3);", 2},
+		{"let sum = fn(...xs) { if (len(xs) == 0) { 0 } else { first(xs) + sum(...tail(xs)) } }; sum(1, 2, 3, 4);", 10},
+		{"let add = fn(x, y, z) { x + y + z }; let xs = [2, 3]; add(1, ...xs);", 6},
+		{"let add = fn(x, y, z) { x + y + z }; add(...[1], 2, ...[3]);", 6},
+		{"len(...[[1, 2, 3]])", 3},
+		{"let f = fn(x = if (true) { return 7 }) { x }; f();", 7},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
 	evaluated := testEval(input)
@@ -292,6 +615,37 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"abc"[0]`, "a"},
+		{`"héllo"[1]`, "é"},
+		{`"日本語"[2]`, "語"},
+		{`"abc"[3]`, nil},
+		{`"abc"[-1]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != expected {
+			t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+		}
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -299,6 +653,7 @@ func TestBuiltinFunctions(t *testing.T) {
 	}{
 		{`len("")`, 0},
 		{`len("four")`, 4},
+		{`len("héllo")`, 5},
 		{`len("hello world")`, 11},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
@@ -306,13 +661,36 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`count("abca", "a")`, 2},
 		{`count("abca", "a")`, 2},
 		{`count("abca")`, "wrong number of arguments. got=1, want=2"},
+		{`first([1, 2])`, 1},
+		{`first([])`, nil},
+		{`last([])`, nil},
+		{`tail([])`, nil},
+		{`int(3.9)`, 3},
+		{`int(-3.9)`, -3},
+		{`int("42")`, 42},
+		{`int("4x")`, "could not parse \"4x\" as int"},
+		{`float(2)`, 2.0},
+		{`float("2.5")`, 2.5},
+		{`float(true)`, "argument to `float` not supported, got BOOLEAN"},
+		{`str(1.0)`, "1.0"},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
 		switch expected := tt.expected.(type) {
+		case nil:
+			testNullObject(t, evaluated)
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
 		case string:
+			if str, ok := evaluated.(*object.String); ok {
+				if str.Value != expected {
+					t.Errorf("wrong string. expected=%q, got=%q", expected, str.Value)
+				}
+				continue
+			}
+
 			errObj, ok := evaluated.(*object.Error)
 			if !ok {
 				t.Errorf("object is not Error. got=%T (%+v)",
@@ -1,10 +1,12 @@
 package interpreter
 
 import (
+	"errors"
 	"fmt"
-	"io"
 	"os"
+	"strings"
 
+	"monkey/diagnostic"
 	"monkey/eval"
 	"monkey/lexer"
 	"monkey/object"
@@ -13,33 +15,37 @@ import (
 
 func Interpreter(path string) error {
 	env := object.NewEnviroment()
-	var out io.Writer
 	f, err := os.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	l := lexer.New(string(f))
+	l := lexer.NewWithFilename(string(f), path)
 	p := parser.NewParser(l)
 	prog := p.ParseProgram()
 
 	if len(p.Errors()) != 0 {
-		printErrors(out, p.Errors())
-		return err
+		return parserErrors(p.Diagnostics(), string(f))
 	}
 
 	evaluated := eval.Eval(prog, env)
 
-	if evaluated != nil {
+	// runtime errors are returned like the vm does, the command prints their traceback
+	if err, ok := evaluated.(*object.Error); ok {
+		return err
+	} else if evaluated != nil {
 		fmt.Println(evaluated.Inspect())
 	}
 
 	return nil
 }
 
-func printErrors(out io.Writer, errors []string) {
-	io.WriteString(out, "Looks like we ran into some monkey business here...\nparser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, msg)
+// renders the parser errors against the source, returned so the command prints them and fails
+func parserErrors(diagnostics []diagnostic.Diagnostic, source string) error {
+	var b strings.Builder
+	b.WriteString("Looks like we ran into some monkey business here...\nparser errors:")
+	for _, d := range diagnostics {
+		b.WriteString("\n\t" + strings.ReplaceAll(d.Render(source), "\n", "\n\t"))
 	}
+	return errors.New(b.String())
 }
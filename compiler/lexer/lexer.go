@@ -1,31 +1,104 @@
 package lexer
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"monkey/diagnostic"
 	"monkey/token"
 )
 
 type Lexer struct {
-	input   string
-	pos     int
-	readPos int
-	ch      byte
+	input    string
+	filename string
+	pos      int
+	readPos  int
+	ch       rune
+	width    int // number of bytes of ch in the input
+	line     int // line of ch
+	col      int // column of ch, counted in characters
+
+	keepComments bool // emit comments as COMMENT tokens instead of skipping them
+	diagnostics  []diagnostic.Diagnostic
 }
 
 func New(s string) *Lexer {
-	l := &Lexer{input: s}
+	return NewWithFilename(s, "")
+}
+
+// lexer that reports the filename in the position of its tokens
+func NewWithFilename(s, filename string) *Lexer {
+	l := &Lexer{input: s, filename: filename, line: 1}
 	l.ReadChar()
 	return l
 }
 
 func (l *Lexer) ReadChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.col = 0
+	}
+
 	if l.readPos >= len(l.input) {
-		l.ch = 0
+		l.ch, l.width = 0, 1
 	} else {
-		l.ch = l.input[l.readPos]
+		l.ch, l.width = utf8.DecodeRuneInString(l.input[l.readPos:])
 	}
 
 	l.pos = l.readPos
-	l.readPos += 1
+	l.readPos += l.width
+	l.col++
+}
+
+func (l *Lexer) peekChar() rune {
+	if l.readPos >= len(l.input) {
+		return 0
+	}
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPos:])
+	return ch
+}
+
+// emit comments as COMMENT tokens, so a formatter can preserve them
+func (l *Lexer) KeepComments(keep bool) {
+	l.keepComments = keep
+}
+
+// lexical errors found so far, like unterminated comments
+func (l *Lexer) Diagnostics() []diagnostic.Diagnostic {
+	return l.diagnostics
+}
+
+// the diagnostics as pos: message strings
+func (l *Lexer) Errors() []string {
+	errors := make([]string, len(l.diagnostics))
+	for i, d := range l.diagnostics {
+		errors[i] = d.String()
+	}
+	return errors
+}
+
+// records an error for the source between start and end
+func (l *Lexer) addError(code diagnostic.Code, start, end token.Position, format string, a ...interface{}) {
+	l.diagnostics = append(l.diagnostics, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Start:    start,
+		End:      end,
+	})
+}
+
+// position of the current char
+func (l *Lexer) position() token.Position {
+	return token.Position{Filename: l.filename, Offset: l.pos, Line: l.line, Column: l.col}
+}
+
+// position right after the current char
+func (l *Lexer) nextPosition() token.Position {
+	return token.Position{Filename: l.filename, Offset: l.readPos, Line: l.line, Column: l.col + 1}
 }
 
 func (l *Lexer) skipWhiteSpace() {
@@ -34,67 +107,353 @@ func (l *Lexer) skipWhiteSpace() {
 	}
 }
 
+// unicode letters and _ can start an identifier
 func (l *Lexer) isChar() bool {
-	return l.ch >= 'a' && l.ch <= 'z' || l.ch >= 'A' && l.ch <= 'Z' || l.ch == '_'
+	return unicode.IsLetter(l.ch) || l.ch == '_'
 }
 
 func (l *Lexer) isDigit() bool {
 	return l.ch >= '0' && l.ch <= '9'
 }
 
-func newToken(tk token.TokenType, s byte) token.Token {
+func newToken(tk token.TokenType, s rune) token.Token {
 	return token.Token{Type: tk, Literal: string(s)}
 }
 
+// identifiers can contain digits after the first character, like x1 or café2
 func (l *Lexer) createIdentifier() token.Token {
-	var s string
+	start := l.pos
 
-	for l.isChar() {
-		s += string(l.ch)
+	for l.isChar() || unicode.IsDigit(l.ch) {
 		l.ReadChar()
 	}
+	s := l.input[start:l.pos]
 	tp := token.LookupIdent(s)
 
 	return token.Token{Type: tp, Literal: s}
 }
 
-func (l *Lexer) createInt() token.Token {
-	var s string
+// reads decimal digits and _ separators
+func (l *Lexer) readDigits() {
+	for l.isDigit() || l.ch == '_' {
+		l.ReadChar()
+	}
+}
+
+// bases of the integer literals prefixed with 0x, 0o and 0b
+var prefixBases = map[rune]int{'x': 16, 'X': 16, 'o': 8, 'O': 8, 'b': 2, 'B': 2}
+
+var baseNames = map[int]string{16: "hex", 8: "octal", 2: "binary"}
+
+// reads an integer, or a float when there is a fraction or an exponent like 3.14 or 1e-9
+func (l *Lexer) createNumber() token.Token {
+	pos := l.position()
+	start := l.pos
+	var tp token.TokenType = token.INT
+
+	if _, ok := prefixBases[l.peekChar()]; ok && l.ch == '0' {
+		return l.createPrefixedInt(pos)
+	}
+
+	l.readDigits()
+
+	if next := l.peekChar(); l.ch == '.' && isDecimal(next) {
+		tp = token.FLOAT
+		l.ReadChar()
+		l.readDigits()
+	}
+
+	if l.ch == 'e' || l.ch == 'E' {
+		tp = token.FLOAT
+		l.ReadChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.ReadChar()
+		}
+
+		if !l.isDigit() {
+			l.addError(diagnostic.MalformedNumber, pos, l.position(), "malformed float literal %s, exponent has no digits", l.input[start:l.pos])
+			return token.Token{Type: token.ILLEGAL, Literal: l.input[start:l.pos]}
+		}
+		l.readDigits()
+	}
+
+	lit := l.input[start:l.pos]
+	if !validSeparators(lit, func(ch byte) bool { return isDecimal(rune(ch)) }, false) {
+		l.addError(diagnostic.MalformedNumber, pos, l.position(), "malformed number literal %s, '_' must separate successive digits", lit)
+		return token.Token{Type: token.ILLEGAL, Literal: lit}
+	}
+
+	if tp == token.INT && len(lit) > 1 && lit[0] == '0' {
+		return l.leadingZero(pos, lit)
+	}
+
+	return token.Token{Type: tp, Literal: lit}
+}
+
+// reports an integer like 017, which other languages read as octal. octal needs the 0o prefix
+// so the literal is rejected instead of being read in either base
+func (l *Lexer) leadingZero(pos token.Position, lit string) token.Token {
+	fix := "0o" + lit[1:]
+	if strings.ContainsAny(lit, "89") {
+		fix = strings.TrimLeft(lit, "0_")
+	}
+
+	l.addError(diagnostic.MalformedNumber, pos, l.position(), "leading zero in integer literal %s, octal literals use the 0o prefix", lit)
+	l.diagnostics[len(l.diagnostics)-1].FixIts = []diagnostic.FixIt{{
+		Message: fmt.Sprintf("did you mean `%s`?", fix),
+		Start:   pos,
+		End:     l.position(),
+		Text:    fix,
+	}}
+	return token.Token{Type: token.ILLEGAL, Literal: lit}
+}
+
+// reads a 0x, 0o or 0b integer, the parser converts it with the base taken from the prefix
+func (l *Lexer) createPrefixedInt(pos token.Position) token.Token {
+	start := l.pos
+	l.ReadChar()
+	base := prefixBases[l.ch]
+	l.ReadChar()
+
+	// letters are read too so 0b102 or 0xfg are reported as a whole
+	for l.isChar() || l.isDigit() {
+		l.ReadChar()
+	}
+
+	lit := l.input[start:l.pos]
+	digits := lit[2:]
+	isBaseDigit := func(ch byte) bool { return digitValue(rune(ch)) < base }
+
+	illegal := func(format string, a ...interface{}) token.Token {
+		l.addError(diagnostic.MalformedNumber, pos, l.position(), format, a...)
+		return token.Token{Type: token.ILLEGAL, Literal: lit}
+	}
+
+	if strings.Trim(digits, "_") == "" {
+		return illegal("malformed %s literal %s, no digits", baseNames[base], lit)
+	}
+
+	for _, ch := range digits {
+		if ch != '_' && digitValue(ch) >= base {
+			return illegal("invalid digit %q in %s literal %s", ch, baseNames[base], lit)
+		}
+	}
+
+	if !validSeparators(digits, isBaseDigit, true) {
+		return illegal("malformed %s literal %s, '_' must separate successive digits", baseNames[base], lit)
+	}
+
+	return token.Token{Type: token.INT, Literal: lit}
+}
+
+// each _ must sit between two digits, prefixed literals also allow it right after the prefix
+func validSeparators(digits string, isDigit func(byte) bool, leading bool) bool {
+	for i := 0; i < len(digits); i++ {
+		if digits[i] != '_' {
+			continue
+		}
+
+		if i+1 == len(digits) || !isDigit(digits[i+1]) {
+			return false
+		}
+
+		if i == 0 && !leading || i > 0 && !isDigit(digits[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// value of a digit in any base up to 16, or 16 when ch is not a digit
+func digitValue(ch rune) int {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return int(ch - '0')
+	case ch >= 'a' && ch <= 'f':
+		return int(ch-'a') + 10
+	case ch >= 'A' && ch <= 'F':
+		return int(ch-'A') + 10
+	default:
+		return 16
+	}
+}
+
+func isDecimal(ch rune) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+var escapes = map[rune]rune{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'\\': '\\',
+	'"':  '"',
+}
+
+// reads a "" string interpreting escapes, returns false when the string is not closed
+func (l *Lexer) readString() (string, bool) {
+	var out strings.Builder
+
+	for {
+		l.ReadChar()
+
+		switch l.ch {
+		case '"':
+			return out.String(), true
+		case 0:
+			return out.String(), false
+		case '\\':
+			l.readEscape(&out)
+		default:
+			out.WriteRune(l.ch)
+		}
+	}
+}
+
+// reads the escape starting at the current \ into out
+func (l *Lexer) readEscape(out *strings.Builder) {
+	pos := l.position()
+	l.ReadChar()
+
+	if ch, ok := escapes[l.ch]; ok {
+		out.WriteRune(ch)
+		return
+	}
+
+	switch l.ch {
+	case 'u':
+		l.readUnicodeEscape(pos, out)
+	case 0:
+		// the unterminated string is reported by readString
+	default:
+		l.addError(diagnostic.InvalidEscape, pos, l.nextPosition(), "unknown escape sequence \\%c", l.ch)
+	}
+}
 
-	for l.isDigit() {
-		s += string(l.ch)
+// reads the {hex} part of a \u{hex} escape
+func (l *Lexer) readUnicodeEscape(pos token.Position, out *strings.Builder) {
+	if l.peekChar() != '{' {
+		l.addError(diagnostic.InvalidEscape, pos, l.nextPosition(), "invalid unicode escape, expected \\u{hex}")
+		return
+	}
+	l.ReadChar()
+
+	start := l.readPos
+	for isHexDigit(l.peekChar()) {
 		l.ReadChar()
 	}
+	hex := l.input[start:l.readPos]
+
+	if l.peekChar() != '}' || len(hex) == 0 || len(hex) > 6 {
+		l.addError(diagnostic.InvalidEscape, pos, l.nextPosition(), "invalid unicode escape, expected \\u{hex}")
+		return
+	}
+	l.ReadChar()
 
-	return token.Token{Type: token.INT, Literal: s}
+	r, _ := strconv.ParseUint(hex, 16, 32)
+	if !utf8.ValidRune(rune(r)) {
+		l.addError(diagnostic.InvalidEscape, pos, l.nextPosition(), "invalid unicode code point \\u{%s}", hex)
+		return
+	}
+	out.WriteRune(rune(r))
+}
+
+func isHexDigit(ch rune) bool {
+	return ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'f' || ch >= 'A' && ch <= 'F'
 }
 
-func (l *Lexer) readString() string {
+// reads a “ string as is, it can span lines and has no escapes
+func (l *Lexer) readRawString() (string, bool) {
 	pos := l.pos + 1
 
 	for {
 		l.ReadChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		if l.ch == '`' {
+			return l.input[pos:l.pos], true
+		}
+		if l.ch == 0 {
+			return l.input[pos:], false
 		}
 	}
+}
 
-	return l.input[pos:l.pos]
+// reads a // or /* */ comment, returns false when a block comment is not closed
+func (l *Lexer) readComment() (string, bool) {
+	pos := l.pos
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.ReadChar()
+		}
+		return l.input[pos:l.pos], true
+	}
+
+	l.ReadChar() // skips the / so /*/ is not a closed comment
+	for {
+		l.ReadChar()
+		if l.ch == 0 {
+			return l.input[pos:], false
+		}
+		if l.ch == '*' && l.peekChar() == '/' {
+			l.ReadChar()
+			l.ReadChar()
+			return l.input[pos:l.pos], true
+		}
+	}
 }
 
 func (l *Lexer) NextToken() token.Token {
 	var tk token.Token
 	l.skipWhiteSpace()
 
+	pos := l.position()
+
 	switch l.ch {
 	case '+':
-		tk = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			l.ReadChar()
+			tk = token.Token{Type: token.PLUS_ASSIGN, Literal: "+="}
+		} else {
+			tk = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tk = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			l.ReadChar()
+			tk = token.Token{Type: token.MINUS_ASSIGN, Literal: "-="}
+		} else {
+			tk = newToken(token.MINUS, l.ch)
+		}
 	case '*':
-		tk = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '=' {
+			l.ReadChar()
+			tk = token.Token{Type: token.ASTERISK_ASSIGN, Literal: "*="}
+		} else {
+			tk = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		tk = newToken(token.PERCENT, l.ch)
+	case '^':
+		tk = newToken(token.BIT_XOR, l.ch)
 	case '/':
-		tk = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '/' || l.peekChar() == '*' {
+			comment, ok := l.readComment()
+			if !ok {
+				l.addError(diagnostic.UnterminatedComment, pos, l.position(), "unterminated block comment")
+			}
+
+			if l.keepComments {
+				return token.Token{Type: token.COMMENT, Literal: comment, Pos: pos, End: l.position()}
+			}
+			return l.NextToken()
+		}
+
+		if l.peekChar() == '=' {
+			l.ReadChar()
+			tk = token.Token{Type: token.SLASH_ASSIGN, Literal: "/="}
+		} else {
+			tk = newToken(token.SLASH, l.ch)
+		}
 	case '(':
 		tk = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -113,25 +472,74 @@ func (l *Lexer) NextToken() token.Token {
 		tk = newToken(token.COLON, l.ch)
 	case ',':
 		tk = newToken(token.COMMA, l.ch)
+	case '.':
+		if strings.HasPrefix(l.input[l.readPos:], "..") {
+			l.ReadChar()
+			l.ReadChar()
+			tk = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			l.addError(diagnostic.IllegalCharacter, pos, l.nextPosition(), "illegal character %q", l.ch)
+			tk = newToken(token.ILLEGAL, l.ch)
+		}
 	case '>':
-		tk = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			l.ReadChar()
+			tk = token.Token{Type: token.GT_EQ, Literal: ">="}
+		} else if l.peekChar() == '>' {
+			l.ReadChar()
+			tk = token.Token{Type: token.SHR, Literal: ">>"}
+		} else {
+			tk = newToken(token.GT, l.ch)
+		}
 	case '<':
-		tk = newToken(token.LT, l.ch)
-	case '"':
+		if l.peekChar() == '=' {
+			l.ReadChar()
+			tk = token.Token{Type: token.LT_EQ, Literal: "<="}
+		} else if l.peekChar() == '<' {
+			l.ReadChar()
+			tk = token.Token{Type: token.SHL, Literal: "<<"}
+		} else {
+			tk = newToken(token.LT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			l.ReadChar()
+			tk = token.Token{Type: token.AND, Literal: "&&"}
+		} else {
+			tk = newToken(token.BIT_AND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			l.ReadChar()
+			tk = token.Token{Type: token.OR, Literal: "||"}
+		} else {
+			tk = newToken(token.BIT_OR, l.ch)
+		}
+	case '"', '`':
+		var ok bool
+		if l.ch == '"' {
+			tk.Literal, ok = l.readString()
+		} else {
+			tk.Literal, ok = l.readRawString()
+		}
+
 		tk.Type = token.STRING
-		tk.Literal = l.readString()
+		if !ok {
+			l.addError(diagnostic.UnterminatedString, pos, l.position(), "unterminated string literal")
+			tk.Type = token.ILLEGAL
+		}
 	case 0:
 		tk.Literal = ""
 		tk.Type = "EOF"
 	case '!':
-		if l.input[l.readPos] == '=' {
+		if l.peekChar() == '=' {
 			l.ReadChar()
 			tk = token.Token{Type: token.NOT_EQ, Literal: "!" + string(l.ch)}
 		} else {
 			tk = newToken(token.BANG, l.ch)
 		}
 	case '=':
-		if l.input[l.readPos] == '=' {
+		if l.peekChar() == '=' {
 			l.ReadChar()
 			tk = token.Token{Type: token.EQ, Literal: string(l.ch) + string(l.ch)}
 		} else {
@@ -141,15 +549,22 @@ func (l *Lexer) NextToken() token.Token {
 		// parse identifiers: read new char until encounters a whitespace
 		if l.isChar() {
 			tk = l.createIdentifier()
+			tk.Pos, tk.End = pos, l.position()
 			return tk
 		} else if l.isDigit() {
-			tk = l.createInt()
+			tk = l.createNumber()
+			tk.Pos, tk.End = pos, l.position()
 			return tk
+		} else if l.ch == utf8.RuneError && l.width == 1 {
+			l.addError(diagnostic.InvalidEncoding, pos, l.nextPosition(), "invalid utf-8 encoding")
+			tk = token.Token{Type: token.ILLEGAL, Literal: l.input[l.pos:l.readPos]}
 		} else {
+			l.addError(diagnostic.IllegalCharacter, pos, l.nextPosition(), "illegal character %q", l.ch)
 			tk = newToken(token.ILLEGAL, l.ch)
 		}
 	}
 
 	l.ReadChar()
+	tk.Pos, tk.End = pos, l.position()
 	return tk
 }
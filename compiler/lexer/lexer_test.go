@@ -1,8 +1,10 @@
 package lexer
 
 import (
+	"fmt"
 	"testing"
 
+	"monkey/diagnostic"
 	"monkey/token"
 )
 
@@ -91,3 +93,646 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x != 10;\n\"ab\" +\n\n!"
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedLine int
+		expectedCol  int
+		expectedOff  int
+	}{
+		{token.LET, 1, 1, 0},
+		{token.IDENT, 1, 5, 4},
+		{token.ASSIGN, 1, 7, 6},
+		{token.INT, 1, 9, 8},
+		{token.SEMICOLON, 1, 10, 9},
+		{token.IDENT, 2, 3, 13},
+		{token.NOT_EQ, 2, 5, 15},
+		{token.INT, 2, 8, 18},
+		{token.SEMICOLON, 2, 10, 20},
+		{token.STRING, 3, 1, 22},
+		{token.PLUS, 3, 6, 27},
+		{token.BANG, 5, 1, 30},
+		{token.EOF, 5, 2, 31},
+	}
+
+	l := NewWithFilename(input, "test.mk")
+
+	for i, tt := range tests {
+		tk := l.NextToken()
+
+		if tk.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - type wrong. expected=%q, got=%q", i, tt.expectedType, tk.Type)
+		}
+
+		if tk.Pos.Line != tt.expectedLine || tk.Pos.Column != tt.expectedCol || tk.Pos.Offset != tt.expectedOff {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d (offset %d), got=%d:%d (offset %d)",
+				i, tt.expectedLine, tt.expectedCol, tt.expectedOff, tk.Pos.Line, tk.Pos.Column, tk.Pos.Offset)
+		}
+
+		if tk.Pos.Filename != "test.mk" {
+			t.Fatalf("tests[%d] - filename wrong. got=%q", i, tk.Pos.Filename)
+		}
+	}
+}
+
+func TestTokenEnds(t *testing.T) {
+	input := "café != \"a\\nb\" 0x1F\n`x\ny`"
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedEnd  token.Position
+	}{
+		{token.IDENT, token.Position{Offset: 5, Line: 1, Column: 5}},
+		{token.NOT_EQ, token.Position{Offset: 8, Line: 1, Column: 8}},
+		{token.STRING, token.Position{Offset: 15, Line: 1, Column: 15}},
+		{token.INT, token.Position{Offset: 20, Line: 1, Column: 20}},
+		{token.STRING, token.Position{Offset: 26, Line: 3, Column: 3}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tk := l.NextToken()
+
+		if tk.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - type wrong. expected=%q, got=%q", i, tt.expectedType, tk.Type)
+		}
+
+		if tk.End != tt.expectedEnd {
+			t.Errorf("tests[%d] - end wrong. expected=%+v, got=%+v", i, tt.expectedEnd, tk.End)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// adds two numbers
+let add = fn(x, y) { /* inline */ x + y }; // trailing
+/* multi
+   line */ 10 / 2`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.COMMENT, "// adds two numbers"},
+		{token.LET, "let"},
+		{token.IDENT, "add"},
+		{token.ASSIGN, "="},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COMMA, ","},
+		{token.IDENT, "y"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.COMMENT, "/* inline */"},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.IDENT, "y"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "// trailing"},
+		{token.COMMENT, "/* multi\n   line */"},
+		{token.INT, "10"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.EOF, ""},
+	}
+
+	for _, keep := range []bool{true, false} {
+		l := New(input)
+		l.KeepComments(keep)
+
+		for i, tt := range tests {
+			if !keep && tt.expectedType == token.COMMENT {
+				continue
+			}
+
+			tk := l.NextToken()
+
+			if tk.Type != tt.expectedType {
+				t.Fatalf("tests[%d] - type wrong. expected=%q, got=%q", i, tt.expectedType, tk.Type)
+			}
+
+			if tk.Literal != tt.expectedLiteral {
+				t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tk.Literal)
+			}
+		}
+
+		if len(l.Errors()) != 0 {
+			t.Fatalf("unexpected errors: %v", l.Errors())
+		}
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"1 /* never closed", []string{"1:3: unterminated block comment"}},
+		{"1 /*/", []string{"1:3: unterminated block comment"}},
+		{"1 /**/", []string{}},
+		{"1 // ends at eof", []string{}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		if tk := l.NextToken(); tk.Type != token.INT {
+			t.Fatalf("expected INT, got=%q", tk.Type)
+		}
+		if tk := l.NextToken(); tk.Type != token.EOF {
+			t.Fatalf("expected EOF, got=%q", tk.Type)
+		}
+
+		if len(l.Errors()) != len(tt.expected) {
+			t.Fatalf("wrong number of errors for %q. expected=%v, got=%v", tt.input, tt.expected, l.Errors())
+		}
+		for i, err := range tt.expected {
+			if l.Errors()[i] != err {
+				t.Errorf("wrong error. expected=%q, got=%q", err, l.Errors()[i])
+			}
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a\nb"`, "a\nb"},
+		{`"\t\r\0"`, "\t\r\x00"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"back\\slash"`, `back\slash`},
+		{`"\u{e9}\u{1F600}"`, "é😀"},
+		{"\"two\nlines\"", "two\nlines"},
+		{"`raw \\n \"quoted\"`", `raw \n "quoted"`},
+		{"`multi\nline`", "multi\nline"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tk := l.NextToken()
+
+		if tk.Type != token.STRING {
+			t.Fatalf("%s - type wrong. expected=%q, got=%q", tt.input, token.STRING, tk.Type)
+		}
+
+		if tk.Literal != tt.expected {
+			t.Errorf("%s - literal wrong. expected=%q, got=%q", tt.input, tt.expected, tk.Literal)
+		}
+
+		if len(l.Errors()) != 0 {
+			t.Errorf("%s - unexpected errors: %v", tt.input, l.Errors())
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedType token.TokenType
+		expected     []string
+	}{
+		{`"never closed`, token.ILLEGAL, []string{"1:1: unterminated string literal"}},
+		{"x `raw\n", token.ILLEGAL, []string{"1:3: unterminated string literal"}},
+		{`"ends in \`, token.ILLEGAL, []string{"1:1: unterminated string literal"}},
+		{`"\q"`, token.STRING, []string{"1:2: unknown escape sequence \\q"}},
+		{`"\u00e9"`, token.STRING, []string{"1:2: invalid unicode escape, expected \\u{hex}"}},
+		{`"\u{}"`, token.STRING, []string{"1:2: invalid unicode escape, expected \\u{hex}"}},
+		{`"\u{110000}"`, token.STRING, []string{"1:2: invalid unicode code point \\u{110000}"}},
+		{"@", token.ILLEGAL, []string{"1:1: illegal character '@'"}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		tk := l.NextToken()
+		if tk.Type == token.IDENT {
+			tk = l.NextToken()
+		}
+
+		if tk.Type != tt.expectedType {
+			t.Errorf("%s - type wrong. expected=%q, got=%q", tt.input, tt.expectedType, tk.Type)
+		}
+
+		if len(l.Errors()) != len(tt.expected) {
+			t.Fatalf("%s - wrong number of errors. expected=%v, got=%v", tt.input, tt.expected, l.Errors())
+		}
+		for i, err := range tt.expected {
+			if l.Errors()[i] != err {
+				t.Errorf("%s - wrong error. expected=%q, got=%q", tt.input, err, l.Errors()[i])
+			}
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input       string
+		code        diagnostic.Code
+		startColumn int
+		endColumn   int
+	}{
+		{"@", diagnostic.IllegalCharacter, 1, 2},
+		{`x "\q"`, diagnostic.InvalidEscape, 4, 6},
+		{`"abc`, diagnostic.UnterminatedString, 1, 5},
+		{"/* abc", diagnostic.UnterminatedComment, 1, 7},
+		{"1_000_", diagnostic.MalformedNumber, 1, 7},
+		{"0b102", diagnostic.MalformedNumber, 1, 6},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for l.NextToken().Type != token.EOF {
+		}
+
+		if len(l.Diagnostics()) != 1 {
+			t.Fatalf("%s - expected 1 diagnostic, got=%v", tt.input, l.Errors())
+		}
+
+		d := l.Diagnostics()[0]
+		if d.Code != tt.code || d.Severity != diagnostic.Error {
+			t.Errorf("%s - wrong kind. expected=%s error, got=%s %s", tt.input, tt.code, d.Code, d.Severity)
+		}
+
+		if d.Start.Column != tt.startColumn || d.End.Column != tt.endColumn {
+			t.Errorf("%s - wrong range. expected=%d-%d, got=%d-%d",
+				tt.input, tt.startColumn, tt.endColumn, d.Start.Column, d.End.Column)
+		}
+	}
+}
+
+func TestLeadingZeroFixIt(t *testing.T) {
+	tests := []struct {
+		input string
+		fix   string
+	}{
+		{"017", "0o17"},
+		{"0_7", "0o_7"},
+		{"09", "9"},
+		{"008", "8"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		l.NextToken()
+
+		if len(l.Diagnostics()) != 1 {
+			t.Fatalf("%s - expected 1 diagnostic, got=%v", tt.input, l.Errors())
+		}
+
+		d := l.Diagnostics()[0]
+		if len(d.FixIts) != 1 || d.FixIts[0].Text != tt.fix {
+			t.Fatalf("%s - expected fix-it %q, got=%+v", tt.input, tt.fix, d.FixIts)
+		}
+
+		if d.FixIts[0].Start != d.Start || d.FixIts[0].End != d.End {
+			t.Errorf("%s - fix-it should replace the literal. got=%+v", tt.input, d.FixIts[0])
+		}
+
+		if d.FixIts[0].Message != fmt.Sprintf("did you mean `%s`?", tt.fix) {
+			t.Errorf("%s - wrong fix-it message. got=%q", tt.input, d.FixIts[0].Message)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := "5 3.14 1e-9 2E+3 0.5 7.method 1."
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2E+3"},
+		{token.FLOAT, "0.5"},
+		{token.INT, "7"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "method"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tk := l.NextToken()
+
+		if tk.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - type wrong. expected=%q, got=%q", i, tt.expectedType, tk.Type)
+		}
+
+		if tk.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tk.Literal)
+		}
+	}
+}
+
+func TestPrefixedNumbersAndSeparators(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedType token.TokenType
+		expectedErr  string
+	}{
+		{"0xff", token.INT, ""},
+		{"0XdeadBEEF", token.INT, ""},
+		{"0o17", token.INT, ""},
+		{"0b1010", token.INT, ""},
+		{"1_000_000", token.INT, ""},
+		{"0x_ff_ff", token.INT, ""},
+		{"1_000.000_5", token.FLOAT, ""},
+		{"1_0e1_0", token.FLOAT, ""},
+		{"0x", token.ILLEGAL, "1:1: malformed hex literal 0x, no digits"},
+		{"0b_", token.ILLEGAL, "1:1: malformed binary literal 0b_, no digits"},
+		{"0b102", token.ILLEGAL, "1:1: invalid digit '2' in binary literal 0b102"},
+		{"0o8", token.ILLEGAL, "1:1: invalid digit '8' in octal literal 0o8"},
+		{"0xfg", token.ILLEGAL, "1:1: invalid digit 'g' in hex literal 0xfg"},
+		{"0xf_", token.ILLEGAL, "1:1: malformed hex literal 0xf_, '_' must separate successive digits"},
+		{"1_", token.ILLEGAL, "1:1: malformed number literal 1_, '_' must separate successive digits"},
+		{"1__0", token.ILLEGAL, "1:1: malformed number literal 1__0, '_' must separate successive digits"},
+		{"1_.5", token.ILLEGAL, "1:1: malformed number literal 1_.5, '_' must separate successive digits"},
+		{"1_e5", token.ILLEGAL, "1:1: malformed number literal 1_e5, '_' must separate successive digits"},
+		{"0", token.INT, ""},
+		{"0.5", token.FLOAT, ""},
+		{"017", token.ILLEGAL, "1:1: leading zero in integer literal 017, octal literals use the 0o prefix"},
+		{"09", token.ILLEGAL, "1:1: leading zero in integer literal 09, octal literals use the 0o prefix"},
+		{"0_1", token.ILLEGAL, "1:1: leading zero in integer literal 0_1, octal literals use the 0o prefix"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tk := l.NextToken()
+
+		if tk.Type != tt.expectedType {
+			t.Errorf("%s - type wrong. expected=%q, got=%q", tt.input, tt.expectedType, tk.Type)
+		}
+
+		if tk.Literal != tt.input {
+			t.Errorf("%s - literal wrong. got=%q", tt.input, tk.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("%s - literal not read whole, next token %q", tt.input, next.Literal)
+		}
+
+		if tt.expectedErr == "" && len(l.Errors()) != 0 {
+			t.Errorf("%s - unexpected errors: %v", tt.input, l.Errors())
+		}
+
+		if tt.expectedErr != "" && (len(l.Errors()) != 1 || l.Errors()[0] != tt.expectedErr) {
+			t.Errorf("%s - wrong errors. expected=%q, got=%v", tt.input, tt.expectedErr, l.Errors())
+		}
+	}
+}
+
+func TestComparisonAndLogicalOperators(t *testing.T) {
+	input := "a <= b >= c < d > e && f || g"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.LT, "<"},
+		{token.IDENT, "d"},
+		{token.GT, ">"},
+		{token.IDENT, "e"},
+		{token.AND, "&&"},
+		{token.IDENT, "f"},
+		{token.OR, "||"},
+		{token.IDENT, "g"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tk := l.NextToken()
+
+		if tk.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - type wrong. expected=%q, got=%q", i, tt.expectedType, tk.Type)
+		}
+
+		if tk.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tk.Literal)
+		}
+	}
+}
+
+func TestLoopKeywords(t *testing.T) {
+	input := "while for break continue const format"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.CONST, "const"},
+		{token.IDENT, "format"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tk := l.NextToken()
+
+		if tk.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - type wrong. expected=%q, got=%q", i, tt.expectedType, tk.Type)
+		}
+
+		if tk.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tk.Literal)
+		}
+	}
+}
+
+func TestAssignmentOperators(t *testing.T) {
+	input := "a = b += c -= d *= e /= f"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "b"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.IDENT, "c"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.IDENT, "d"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.IDENT, "e"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.IDENT, "f"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tk := l.NextToken()
+
+		if tk.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - type wrong. expected=%q, got=%q", i, tt.expectedType, tk.Type)
+		}
+
+		if tk.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tk.Literal)
+		}
+	}
+}
+
+func TestEllipsis(t *testing.T) {
+	input := "fn(a, ...rest) { f(...rest, 1.5) }"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.COMMA, ","},
+		{token.FLOAT, "1.5"},
+		{token.RPAREN, ")"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tk := l.NextToken()
+
+		if tk.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - type wrong. expected=%q, got=%q", i, tt.expectedType, tk.Type)
+		}
+
+		if tk.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tk.Literal)
+		}
+	}
+
+	// fewer than three dots are not a token
+	l = New("a..b")
+	l.NextToken()
+	if tk := l.NextToken(); tk.Type != token.ILLEGAL {
+		t.Fatalf("expected ILLEGAL token for \"..\". got=%q", tk.Type)
+	}
+	if errors := l.Errors(); len(errors) == 0 || errors[0] != "1:2: illegal character '.'" {
+		t.Fatalf("wrong errors for \"..\". got=%q", errors)
+	}
+}
+
+func TestArithmeticAndBitwiseOperators(t *testing.T) {
+	input := "a % b & c | d ^ e << f >> g"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "b"},
+		{token.BIT_AND, "&"},
+		{token.IDENT, "c"},
+		{token.BIT_OR, "|"},
+		{token.IDENT, "d"},
+		{token.BIT_XOR, "^"},
+		{token.IDENT, "e"},
+		{token.SHL, "<<"},
+		{token.IDENT, "f"},
+		{token.SHR, ">>"},
+		{token.IDENT, "g"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tk := l.NextToken()
+
+		if tk.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - type wrong. expected=%q, got=%q", i, tt.expectedType, tk.Type)
+		}
+
+		if tk.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tk.Literal)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "let x1 = café2 + \"日本\";\n名前"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedCol     int
+		expectedOff     int
+	}{
+		{token.LET, "let", 1, 0},
+		{token.IDENT, "x1", 5, 4},
+		{token.ASSIGN, "=", 8, 7},
+		{token.IDENT, "café2", 10, 9},
+		{token.PLUS, "+", 16, 16},
+		{token.STRING, "日本", 18, 18},
+		{token.SEMICOLON, ";", 22, 26},
+		{token.IDENT, "名前", 1, 28},
+		{token.EOF, "", 3, 34},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tk := l.NextToken()
+
+		if tk.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - type wrong. expected=%q, got=%q", i, tt.expectedType, tk.Type)
+		}
+
+		if tk.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tk.Literal)
+		}
+
+		if tk.Pos.Column != tt.expectedCol || tk.Pos.Offset != tt.expectedOff {
+			t.Fatalf("tests[%d] - position wrong. expected col %d (offset %d), got col %d (offset %d)",
+				i, tt.expectedCol, tt.expectedOff, tk.Pos.Column, tk.Pos.Offset)
+		}
+	}
+
+	l = New("1 \xff")
+	l.NextToken()
+	if tk := l.NextToken(); tk.Type != token.ILLEGAL {
+		t.Fatalf("expected ILLEGAL for invalid utf-8, got=%q", tk.Type)
+	}
+	if len(l.Errors()) != 1 || l.Errors()[0] != "1:3: invalid utf-8 encoding" {
+		t.Errorf("wrong errors. got=%v", l.Errors())
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 
+	"monkey/diff"
 	"monkey/interpreter"
+	"monkey/object"
 	"monkey/repl"
 	"monkey/vm"
 )
@@ -16,7 +18,8 @@ func main() {
 				fmt.Print("File not found...")
 				return
 			} else if err := interpreter.Interpreter(os.Args[2]); err != nil {
-				panic(err)
+				printError(err)
+				os.Exit(1)
 			}
 			return
 		} else if os.Args[1] == "r" {
@@ -29,11 +32,30 @@ func main() {
 				fmt.Print("File not found...")
 				return
 			} else if err := vm.CompileRunVM(os.Args[2]); err != nil {
-				panic(err)
+				printError(err)
+				os.Exit(1)
+			}
+		} else if os.Args[1] == "diff" {
+			if len(os.Args) < 3 {
+				fmt.Print("File not found...")
+				return
+			} else if err := diff.DiffFile(os.Args[2]); err != nil {
+				printError(err)
+				os.Exit(1)
 			}
 		} else {
-			fmt.Print("Invalid argument, use c, i, r")
+			fmt.Print("Invalid argument, use c, i, r, diff")
 			return
 		}
 	}
 }
+
+// compile and runtime errors of the program are printed like the evaluator does, with their
+// position and the calls they propagated out of
+func printError(err error) {
+	if e, ok := err.(*object.Error); ok {
+		fmt.Println(e.Traceback())
+		return
+	}
+	fmt.Println(err)
+}
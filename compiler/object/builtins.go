@@ -0,0 +1,227 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type BuiltinDef struct {
+	Name    string
+	Builtin *Builtin
+}
+
+// builtin functions shared by the evaluator and the vm, the vm refers to them by index
+// so new builtins must only be appended
+var Builtins = []BuiltinDef{
+	{
+		"len",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *String:
+				// length in characters, not bytes
+				return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+			case *Array:
+				return &Integer{Value: int64(len(arg.Elements))}
+			default:
+				return newError("argument to `len` not supported, got %s", args[0].Type())
+			}
+		}},
+	},
+	{
+		"count",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *String:
+				if substr, ok := args[1].(*String); ok {
+					return &Integer{Value: int64(strings.Count(arg.Value, substr.Value))}
+				} else {
+					return newError("argument 1 to `count` not supported, got %s", args[1].Type())
+				}
+			default:
+				return newError("argument 0 to `count` not supported, got %s", args[0].Type())
+			}
+		}},
+	},
+	{
+		"first",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
+			}
+
+			a := args[0].(*Array)
+			if len(a.Elements) > 0 {
+				return a.Elements[0]
+			}
+			return nil
+		}},
+	},
+	{
+		"last",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
+			}
+
+			a := args[0].(*Array)
+			if len(a.Elements) > 0 {
+				return a.Elements[len(a.Elements)-1]
+			}
+			return nil
+		}},
+	},
+	{
+		"tail",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `tail` must be ARRAY, got %s", args[0].Type())
+			}
+
+			a := args[0].(*Array)
+			if len(a.Elements) > 0 {
+				newElements := make([]Object, (len(a.Elements) - 1), (len(a.Elements) - 1))
+				copy(newElements, a.Elements[1:(len(a.Elements))])
+				return &Array{Elements: newElements}
+			}
+			return nil
+		}},
+	},
+	{
+		"push",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+			}
+
+			a := args[0].(*Array)
+			newElements := make([]Object, (len(a.Elements) + 1), (len(a.Elements) + 1))
+			copy(newElements, a.Elements)
+			newElements[len(a.Elements)] = args[1]
+			return &Array{Elements: newElements}
+		}},
+	},
+	{
+		"int",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer, *BigInteger:
+				return arg
+			case *Float:
+				// floats are truncated towards zero
+				if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+					return newError("float %s out of int range", arg.Inspect())
+				}
+				v, _ := big.NewFloat(arg.Value).Int(nil)
+				return NewInteger(v)
+			case *String:
+				v, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 0)
+				if !ok {
+					return newError("could not parse %q as int", arg.Value)
+				}
+				return NewInteger(v)
+			default:
+				return newError("argument to `int` not supported, got %s", args[0].Type())
+			}
+		}},
+	},
+	{
+		"float",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer, *BigInteger:
+				return &Float{Value: IntegerToFloat(arg)}
+			case *Float:
+				return arg
+			case *String:
+				v, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil {
+					return newError("could not parse %q as float", arg.Value)
+				}
+				return &Float{Value: v}
+			default:
+				return newError("argument to `float` not supported, got %s", args[0].Type())
+			}
+		}},
+	},
+	{
+		"str",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			return &String{Value: args[0].Inspect()}
+		}},
+	},
+}
+
+// max number of builtins, the vm refers to them with the 1 byte operand of OpGetBuiltin
+const MaxBuiltins = 256
+
+// registers a go function as a builtin for both the evaluator and the vm, a builtin with the
+// same name is replaced in place so its index doesnt change. must be called before compiling
+func RegisterBuiltin(name string, fn BuiltinFunction) error {
+	for i, def := range Builtins {
+		if def.Name == name {
+			Builtins[i].Builtin = &Builtin{Fn: fn}
+			return nil
+		}
+	}
+
+	if len(Builtins) >= MaxBuiltins {
+		return fmt.Errorf("too many builtins, cannot register %s: max is %d", name, MaxBuiltins)
+	}
+
+	Builtins = append(Builtins, BuiltinDef{Name: name, Builtin: &Builtin{Fn: fn}})
+	return nil
+}
+
+// builtins return nil when there is no value, callers turn it into their null object
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Value: fmt.Sprintf(format, a...)}
+}
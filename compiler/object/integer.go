@@ -0,0 +1,216 @@
+package object
+
+import (
+	"hash/fnv"
+	"math"
+	"math/big"
+)
+
+// integer that doesnt fit in an int64, it reports the same type as Integer so users never see
+// the difference. values are always normalized: a BigInteger never holds a value that fits int64
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (bi *BigInteger) Type() ObjectType { return INTEGER_OBJ }
+func (bi *BigInteger) Inspect() string  { return bi.Value.String() }
+
+// equal values always have the same representation, so big integers only hash to big integers
+func (bi *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	if bi.Value.Sign() < 0 {
+		h.Write([]byte{'-'})
+	}
+	h.Write(bi.Value.Bytes())
+	return HashKey{Type: bi.Type(), Value: h.Sum64()}
+}
+
+// integer object for v, demoted to Integer when it fits in an int64
+func NewInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &BigInteger{Value: v}
+}
+
+// value of an Integer or BigInteger as a big.Int
+func toBig(obj Object) *big.Int {
+	if i, ok := obj.(*Integer); ok {
+		return big.NewInt(i.Value)
+	}
+	return obj.(*BigInteger).Value
+}
+
+// integer arithmetic shared by the evaluator and the vm, results that overflow an int64 are
+// promoted to BigInteger and big results that fit are demoted back to Integer
+func AddIntegers(l, r Object) Object {
+	if a, b, ok := smallIntegers(l, r); ok {
+		if s := a + b; (s > a) == (b > 0) {
+			return &Integer{Value: s}
+		}
+	}
+	return NewInteger(new(big.Int).Add(toBig(l), toBig(r)))
+}
+
+func SubIntegers(l, r Object) Object {
+	if a, b, ok := smallIntegers(l, r); ok {
+		if d := a - b; (d < a) == (b > 0) {
+			return &Integer{Value: d}
+		}
+	}
+	return NewInteger(new(big.Int).Sub(toBig(l), toBig(r)))
+}
+
+func MulIntegers(l, r Object) Object {
+	if a, b, ok := smallIntegers(l, r); ok {
+		if a == 0 || b == 0 {
+			return &Integer{Value: 0}
+		}
+
+		p := a * b
+		if p/b == a && !(a == -1 && b == math.MinInt64) && !(b == -1 && a == math.MinInt64) {
+			return &Integer{Value: p}
+		}
+	}
+	return NewInteger(new(big.Int).Mul(toBig(l), toBig(r)))
+}
+
+// truncated division like go
+func DivIntegers(l, r Object) Object {
+	if isZero(r) {
+		return newError("division by zero")
+	}
+
+	if a, b, ok := smallIntegers(l, r); ok && !(a == math.MinInt64 && b == -1) {
+		return &Integer{Value: a / b}
+	}
+	return NewInteger(new(big.Int).Quo(toBig(l), toBig(r)))
+}
+
+// remainder of the truncated division, it has the sign of l like in go
+func ModIntegers(l, r Object) Object {
+	if isZero(r) {
+		return newError("division by zero")
+	}
+
+	if a, b, ok := smallIntegers(l, r); ok {
+		return &Integer{Value: a % b}
+	}
+	return NewInteger(new(big.Int).Rem(toBig(l), toBig(r)))
+}
+
+// bitwise operators use two's complement for negative values, big integers included
+func AndIntegers(l, r Object) Object {
+	if a, b, ok := smallIntegers(l, r); ok {
+		return &Integer{Value: a & b}
+	}
+	return NewInteger(new(big.Int).And(toBig(l), toBig(r)))
+}
+
+func OrIntegers(l, r Object) Object {
+	if a, b, ok := smallIntegers(l, r); ok {
+		return &Integer{Value: a | b}
+	}
+	return NewInteger(new(big.Int).Or(toBig(l), toBig(r)))
+}
+
+func XorIntegers(l, r Object) Object {
+	if a, b, ok := smallIntegers(l, r); ok {
+		return &Integer{Value: a ^ b}
+	}
+	return NewInteger(new(big.Int).Xor(toBig(l), toBig(r)))
+}
+
+// max left shift count, bigger shifts would allocate huge integers
+const maxShiftCount = 1 << 16
+
+func ShiftLeftIntegers(l, r Object) Object {
+	n, err := shiftCount(r)
+	if err != nil {
+		return err
+	}
+
+	if n > maxShiftCount {
+		return newError("shift count too large: %s", r.Inspect())
+	}
+
+	if a, ok := l.(*Integer); ok && n < 63 {
+		if s := a.Value << n; s>>n == a.Value {
+			return &Integer{Value: s}
+		}
+	}
+	return NewInteger(new(big.Int).Lsh(toBig(l), uint(n)))
+}
+
+// arithmetic shift, negative values stay negative
+func ShiftRightIntegers(l, r Object) Object {
+	n, err := shiftCount(r)
+	if err != nil {
+		return err
+	}
+
+	if a, ok := l.(*Integer); ok {
+		return &Integer{Value: a.Value >> n}
+	}
+	return NewInteger(new(big.Int).Rsh(toBig(l), uint(n)))
+}
+
+// shift counts that dont fit an int64 are clamped, they shift every bit out anyway
+func shiftCount(r Object) (int64, *Error) {
+	if CompareIntegers(r, &Integer{Value: 0}) < 0 {
+		return 0, newError("negative shift count: %s", r.Inspect())
+	}
+
+	if n, ok := r.(*Integer); ok {
+		return n.Value, nil
+	}
+	return math.MaxInt64, nil
+}
+
+func NegateInteger(obj Object) Object {
+	if i, ok := obj.(*Integer); ok && i.Value != math.MinInt64 {
+		return &Integer{Value: -i.Value}
+	}
+	return NewInteger(new(big.Int).Neg(toBig(obj)))
+}
+
+// -1, 0 or 1 when l is less, equal or greater than r
+func CompareIntegers(l, r Object) int {
+	if a, b, ok := smallIntegers(l, r); ok {
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return toBig(l).Cmp(toBig(r))
+}
+
+// value of an Integer or BigInteger as the nearest float
+func IntegerToFloat(obj Object) float64 {
+	if i, ok := obj.(*Integer); ok {
+		return float64(i.Value)
+	}
+	f, _ := new(big.Float).SetInt(obj.(*BigInteger).Value).Float64()
+	return f
+}
+
+func isZero(obj Object) bool {
+	i, ok := obj.(*Integer)
+	return ok && i.Value == 0
+}
+
+func smallIntegers(l, r Object) (int64, int64, bool) {
+	a, ok := l.(*Integer)
+	if !ok {
+		return 0, 0, false
+	}
+	b, ok := r.(*Integer)
+	if !ok {
+		return 0, 0, false
+	}
+	return a.Value, b.Value, true
+}
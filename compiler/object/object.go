@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 
 	"monkey/ast"
+	"monkey/code"
+	"monkey/token"
 )
 
 type ObjectType string
@@ -15,15 +20,20 @@ type BuiltinFunction func(args ...Object) Object
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
 	ERROR_OBJ        = "ERROR"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 	FUNCTION_OBJ     = "FUNCTION"
 	ARRAY_OBJ        = "ARRAY"
 	NULL_OBJ         = "NULL"
 	HASH_OBJ         = "HASH"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 )
 
 type Object interface {
@@ -39,6 +49,10 @@ type Integer struct {
 	Value int64
 }
 
+type Float struct {
+	Value float64
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -51,10 +65,35 @@ type Return struct {
 	Value Object
 }
 
+// break and continue unwind the blocks of the loop body like a return
+type Break struct{}
+
+type Continue struct{}
+
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // evaluated when the argument is missing, nil for required parameters
+	Rest       *ast.Identifier  // collects the extra arguments into an array, nil when there is none
 	Body       *ast.BlockStatement
 	Env        *Enviroment
+	Name       string // name of the let binding, empty for anonymous functions
+}
+
+// function produced by the bytecode compiler
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int // number of local bindings, reserved on the stack when called
+	NumParameters int // the rest parameter is not counted, it is the local right after the others
+	NumDefaults   int // the last parameters have a default value and can be left out
+	Variadic      bool
+	SourceMap     code.SourceMap // source positions of the instructions, used in runtime errors
+	Name          string         // name of the let binding, empty for anonymous functions
+}
+
+// compiled function together with the values of the free variables it captured
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
 }
 
 type Builtin struct {
@@ -79,17 +118,34 @@ type Hash struct {
 	Pairs map[HashKey]HashPair
 }
 
+// runtime error, also used as a go error by the compiler and the vm
 type Error struct {
 	Value string
+	Pos   token.Position // where the error happened, invalid when unknown
+	Stack []CallSite     // calls the error propagated out of, innermost first
+}
+
+type CallSite struct {
+	Function string         // name of the called function, empty for anonymous functions
+	Pos      token.Position // position of the call expression
 }
 
+// max number of call sites printed in a traceback, deep recursion would flood the output
+const maxTracebackCalls = 20
+
 type Null struct{}
 
 type Enviroment struct {
-	store map[string]Object
+	store map[string]binding
 	outer *Enviroment
 }
 
+type binding struct {
+	value    Object
+	constant bool     // bound with const, assignments are rejected
+	decl     ast.Node // statement that declared the constant
+}
+
 func (b *Boolean) HashKey() HashKey {
 	var v uint64
 
@@ -106,6 +162,15 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// integral floats hash like the integer they are equal to, so h[1.0] finds h[1]
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		i, _ := big.NewFloat(f.Value).Int(nil)
+		return NewInteger(i).(Hashable).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -119,30 +184,75 @@ func NewEnclosedEnviroment(outer *Enviroment) *Enviroment {
 }
 
 func NewEnviroment() *Enviroment {
-	s := make(map[string]Object)
+	s := make(map[string]binding)
 	return &Enviroment{store: s, outer: nil}
 }
 
 func (e *Enviroment) Value(name string) (Object, bool) {
-	obj, ok := e.store[name]
+	b, ok := e.store[name]
 	if !ok && e.outer != nil {
-		obj, ok = e.outer.Value(name)
+		return e.outer.Value(name)
 	}
-	return obj, ok
+	return b.value, ok
 }
 
 func (e *Enviroment) Add(name string, obj Object) Object {
-	e.store[name] = obj
+	e.store[name] = binding{value: obj}
+	return obj
+}
+
+// adds a binding declared by decl that cant be assigned, see Redeclares
+func (e *Enviroment) AddConst(name string, obj Object, decl ast.Node) Object {
+	e.store[name] = binding{value: obj, constant: true, decl: decl}
 	return obj
 }
 
+// reports whether decl declares again a constant of this scope, not of the enclosing ones.
+// a declaration inside a loop runs again for each iteration, that is not a redeclaration
+func (e *Enviroment) Redeclares(name string, decl ast.Node) bool {
+	b := e.store[name]
+	return b.constant && b.decl != decl
+}
+
+// reports whether the innermost binding of name was added with AddConst
+func (e *Enviroment) IsConst(name string) bool {
+	b, ok := e.store[name]
+	if !ok && e.outer != nil {
+		return e.outer.IsConst(name)
+	}
+	return b.constant
+}
+
+// updates the binding of the innermost scope that defines name, false when no scope does.
+// callers check IsConst first
+func (e *Enviroment) Assign(name string, obj Object) bool {
+	if b, ok := e.store[name]; ok {
+		b.value = obj
+		e.store[name] = b
+		return true
+	}
+
+	if e.outer != nil {
+		return e.outer.Assign(name, obj)
+	}
+	return false
+}
+
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	for i, p := range f.Parameters {
+		if i < len(f.Defaults) && f.Defaults[i] != nil {
+			params = append(params, p.String()+" = "+f.Defaults[i].String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
 	}
 
 	out.WriteString("fn(")
@@ -154,9 +264,37 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// number of arguments a call has to pass at least
+func (f *Function) Required() int {
+	for i := range f.Parameters {
+		if i < len(f.Defaults) && f.Defaults[i] != nil {
+			return i
+		}
+	}
+	return len(f.Parameters)
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string  { return fmt.Sprintf("CompiledFunction[%p]", cf) }
+
+// closures are the functions of the compiled language, so they report the same type as eval functions
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string  { return fmt.Sprintf("Closure[%p]", c) }
+
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// always shows a fraction or an exponent so floats are not mistaken for integers
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
 
@@ -166,6 +304,12 @@ func (s *String) Inspect() string  { return s.Value }
 func (rt *Return) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rt *Return) Inspect() string  { return rt.Value.Inspect() }
 
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
 func (bt *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (bt *Builtin) Inspect() string  { return "builtin function" }
 
@@ -203,7 +347,81 @@ func (h *Hash) Inspect() string {
 }
 
 func (err *Error) Type() ObjectType { return ERROR_OBJ }
-func (err *Error) Inspect() string  { return "ERROR: " + err.Value }
+func (err *Error) Inspect() string  { return "ERROR: " + err.Error() }
+
+func (err *Error) Error() string {
+	if err.Pos.IsValid() {
+		return err.Pos.String() + ": " + err.Value
+	}
+	return err.Value
+}
+
+// error message followed by the calls it propagated out of
+func (err *Error) Traceback() string {
+	var out bytes.Buffer
+
+	out.WriteString(err.Inspect())
+
+	for i, call := range err.Stack {
+		if i == maxTracebackCalls {
+			fmt.Fprintf(&out, "\n\t... %d more calls", len(err.Stack)-maxTracebackCalls)
+			break
+		}
+
+		name := call.Function
+		if name == "" {
+			name = "anonymous function"
+		}
+		fmt.Fprintf(&out, "\n\tin %s, called at %s", name, call.Pos)
+	}
+
+	return out.String()
+}
 
 func (n *Null) Type() ObjectType { return NULL_OBJ }
 func (n *Null) Inspect() string  { return "null" }
+
+// assigns value to left[index] in place, shared by the evaluator and the vm
+func SetIndex(left, index, value Object) *Error {
+	switch left := left.(type) {
+	case *Array:
+		if index.Type() != INTEGER_OBJ {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+
+		// big integers are always out of range
+		idx, ok := index.(*Integer)
+		if !ok || idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %s", index.Inspect())
+		}
+
+		left.Elements[idx.Value] = value
+	case *Hash:
+		key, ok := index.(Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+
+		left.Pairs[key.HashKey()] = HashPair{Key: index, Value: value}
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+	return nil
+}
+
+// checks the number of arguments of a call to a function with params parameters, the first
+// required of them without a default value. shared so the evaluator and the vm report the same
+func CheckArity(got, required, params int, variadic bool) *Error {
+	switch {
+	case variadic && got < required:
+		return newError("wrong number of arguments. got=%d, want>=%d", got, required)
+	case variadic:
+		return nil
+	case got >= required && got <= params:
+		return nil
+	case required == params:
+		return newError("wrong number of arguments. got=%d, want=%d", got, params)
+	default:
+		return newError("wrong number of arguments. got=%d, want=%d..%d", got, required, params)
+	}
+}
@@ -1,6 +1,14 @@
 package object
 
-import "testing"
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"monkey/ast"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -17,3 +25,275 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestFloatHashKey(t *testing.T) {
+	if (&Float{Value: 2.0}).HashKey() != (&Integer{Value: 2}).HashKey() {
+		t.Errorf("integral float has different hash key than the equal integer")
+	}
+	if (&Float{Value: -0.0}).HashKey() != (&Float{Value: 0.0}).HashKey() {
+		t.Errorf("-0.0 and 0.0 have different hash keys")
+	}
+	if (&Float{Value: 2.5}).HashKey() == (&Float{Value: 3.5}).HashKey() {
+		t.Errorf("floats with different values have same hash keys")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3, "3.0"},
+		{-2.5, "-2.5"},
+		{1e-9, "1e-09"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tt := range tests {
+		if got := (&Float{Value: tt.value}).Inspect(); got != tt.expected {
+			t.Errorf("wrong inspect. expected=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestIntegerPromotion(t *testing.T) {
+	max := &Integer{Value: math.MaxInt64}
+	min := &Integer{Value: math.MinInt64}
+
+	tests := []struct {
+		result   Object
+		expected string
+		big      bool
+	}{
+		{AddIntegers(max, &Integer{Value: 1}), "9223372036854775808", true},
+		{SubIntegers(min, &Integer{Value: 1}), "-9223372036854775809", true},
+		{MulIntegers(max, &Integer{Value: 2}), "18446744073709551614", true},
+		{MulIntegers(min, &Integer{Value: -1}), "9223372036854775808", true},
+		{DivIntegers(min, &Integer{Value: -1}), "9223372036854775808", true},
+		{NegateInteger(min), "9223372036854775808", true},
+		{AddIntegers(&Integer{Value: 2}, &Integer{Value: 3}), "5", false},
+		{SubIntegers(AddIntegers(max, &Integer{Value: 1}), &Integer{Value: 1}), "9223372036854775807", false},
+		{DivIntegers(MulIntegers(max, max), max), "9223372036854775807", false},
+	}
+
+	for i, tt := range tests {
+		if tt.result.Inspect() != tt.expected {
+			t.Errorf("tests[%d] wrong value. expected=%s, got=%s", i, tt.expected, tt.result.Inspect())
+		}
+
+		if _, isBig := tt.result.(*BigInteger); isBig != tt.big {
+			t.Errorf("tests[%d] wrong representation. expected big=%t, got=%T", i, tt.big, tt.result)
+		}
+
+		if tt.result.Type() != INTEGER_OBJ {
+			t.Errorf("tests[%d] wrong type. got=%s", i, tt.result.Type())
+		}
+	}
+}
+
+func TestBigIntegerHashKey(t *testing.T) {
+	one := &Integer{Value: 1}
+	max := &Integer{Value: math.MaxInt64}
+
+	big1 := AddIntegers(max, one).(Hashable)
+	big2 := SubIntegers(MulIntegers(max, &Integer{Value: 2}), SubIntegers(max, one)).(Hashable)
+	if big1.HashKey() != big2.HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+
+	neg := NegateInteger(big1.(Object)).(Hashable)
+	if big1.HashKey() == neg.HashKey() {
+		t.Errorf("big integers with different signs have same hash keys")
+	}
+
+	demoted := SubIntegers(big1.(Object), one).(Hashable)
+	if demoted.HashKey() != max.HashKey() {
+		t.Errorf("demoted integer has different hash key than the equal integer")
+	}
+
+	if (&Float{Value: 1e20}).HashKey() != MulIntegers(&Integer{Value: 1e10}, &Integer{Value: 1e10}).(Hashable).HashKey() {
+		t.Errorf("integral float has different hash key than the equal big integer")
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	saved := slices.Clone(Builtins)
+	t.Cleanup(func() { Builtins = saved })
+
+	before := len(Builtins)
+
+	if err := RegisterBuiltin("answer", func(args ...Object) Object {
+		return &Integer{Value: 42}
+	}); err != nil {
+		t.Fatalf("RegisterBuiltin returned error: %s", err)
+	}
+
+	if len(Builtins) != before+1 {
+		t.Fatalf("builtin not appended. got=%d builtins, want=%d", len(Builtins), before+1)
+	}
+
+	if Builtins[before].Name != "answer" {
+		t.Errorf("builtin registered with wrong name. got=%q", Builtins[before].Name)
+	}
+
+	if err := RegisterBuiltin("answer", func(args ...Object) Object {
+		return &Integer{Value: 43}
+	}); err != nil {
+		t.Fatalf("RegisterBuiltin returned error: %s", err)
+	}
+
+	if len(Builtins) != before+1 {
+		t.Fatalf("builtin with same name was appended. got=%d builtins", len(Builtins))
+	}
+
+	result := GetBuiltinByName("answer").Fn()
+	if i, ok := result.(*Integer); !ok || i.Value != 43 {
+		t.Errorf("builtin was not replaced. got=%+v", result)
+	}
+}
+
+func TestRegisterBuiltinLimit(t *testing.T) {
+	saved := slices.Clone(Builtins)
+	t.Cleanup(func() { Builtins = saved })
+
+	fn := func(args ...Object) Object { return nil }
+	for i := len(Builtins); i < MaxBuiltins; i++ {
+		if err := RegisterBuiltin(fmt.Sprintf("builtin%d", i), fn); err != nil {
+			t.Fatalf("RegisterBuiltin returned error for builtin %d: %s", i, err)
+		}
+	}
+
+	err := RegisterBuiltin("overflow", fn)
+	if err == nil {
+		t.Fatalf("expected error past %d builtins, got none", MaxBuiltins)
+	}
+
+	if err.Error() != "too many builtins, cannot register overflow: max is 256" {
+		t.Errorf("wrong error. got=%q", err)
+	}
+
+	// replacing an existing builtin doesnt take a new index
+	if err := RegisterBuiltin("len", fn); err != nil {
+		t.Errorf("replacing a builtin returned error: %s", err)
+	}
+}
+
+func TestConstBindings(t *testing.T) {
+	outer := NewEnviroment()
+	decl := &ast.LetStatement{Const: true}
+	outer.AddConst("x", &Integer{Value: 1}, decl)
+
+	inner := NewEnclosedEnviroment(outer)
+	if !inner.IsConst("x") {
+		t.Errorf("x of the outer enviroment is not constant")
+	}
+
+	if !outer.Redeclares("x", &ast.LetStatement{}) || inner.Redeclares("x", &ast.LetStatement{}) {
+		t.Errorf("Redeclares should only report the constants of its own scope")
+	}
+
+	if outer.Redeclares("x", decl) {
+		t.Errorf("running the same declaration again is not a redeclaration")
+	}
+
+	inner.Add("x", &Integer{Value: 2})
+	if inner.IsConst("x") {
+		t.Errorf("shadowing x with Add kept it constant")
+	}
+
+	if !inner.Assign("x", &Integer{Value: 3}) {
+		t.Fatalf("assigning shadowed x failed")
+	}
+
+	if v, _ := outer.Value("x"); v.(*Integer).Value != 1 {
+		t.Errorf("assignment changed the outer x. got=%s", v.Inspect())
+	}
+}
+
+func TestTracebackTruncation(t *testing.T) {
+	err := &Error{Value: "boom"}
+	for i := 0; i < maxTracebackCalls+5; i++ {
+		err.Stack = append(err.Stack, CallSite{})
+	}
+
+	lines := strings.Split(err.Traceback(), "\n")
+	if len(lines) != maxTracebackCalls+2 {
+		t.Fatalf("wrong number of lines. want=%d, got=%d", maxTracebackCalls+2, len(lines))
+	}
+
+	if lines[1] != "\tin anonymous function, called at 0:0" {
+		t.Errorf("wrong call line. got=%q", lines[1])
+	}
+
+	if lines[len(lines)-1] != "\t... 5 more calls" {
+		t.Errorf("wrong last line. got=%q", lines[len(lines)-1])
+	}
+}
+
+func TestIntegerDivisionErrors(t *testing.T) {
+	zero := &Integer{Value: 0}
+	one := &Integer{Value: 1}
+	big := MulIntegers(&Integer{Value: math.MaxInt64}, &Integer{Value: 4})
+
+	tests := []struct {
+		result   Object
+		expected string
+	}{
+		{DivIntegers(one, zero), "division by zero"},
+		{ModIntegers(big, zero), "division by zero"},
+		{ShiftLeftIntegers(one, &Integer{Value: -1}), "negative shift count: -1"},
+		{ShiftRightIntegers(one, NegateInteger(big)), "negative shift count: -36893488147419103228"},
+		{ShiftLeftIntegers(one, big), "shift count too large: 36893488147419103228"},
+	}
+
+	for i, tt := range tests {
+		err, ok := tt.result.(*Error)
+		if !ok {
+			t.Errorf("tests[%d] not an error. got=%T (%+v)", i, tt.result, tt.result)
+			continue
+		}
+
+		if err.Value != tt.expected {
+			t.Errorf("tests[%d] wrong error. expected=%q, got=%q", i, tt.expected, err.Value)
+		}
+	}
+
+	if got := ModIntegers(&Integer{Value: math.MinInt64}, &Integer{Value: -1}).Inspect(); got != "0" {
+		t.Errorf("wrong remainder. got=%s", got)
+	}
+	if got := ShiftRightIntegers(NegateInteger(big), big).Inspect(); got != "-1" {
+		t.Errorf("wrong shift. got=%s", got)
+	}
+}
+
+func TestCheckArity(t *testing.T) {
+	tests := []struct {
+		got, required, params int
+		variadic              bool
+		expected              string
+	}{
+		{2, 2, 2, false, ""},
+		{1, 2, 2, false, "wrong number of arguments. got=1, want=2"},
+		{1, 1, 3, false, ""},
+		{3, 1, 3, false, ""},
+		{4, 1, 3, false, "wrong number of arguments. got=4, want=1..3"},
+		{0, 1, 3, false, "wrong number of arguments. got=0, want=1..3"},
+		{5, 1, 1, true, ""},
+		{0, 1, 1, true, "wrong number of arguments. got=0, want>=1"},
+	}
+
+	for i, tt := range tests {
+		err := CheckArity(tt.got, tt.required, tt.params, tt.variadic)
+
+		var msg string
+		if err != nil {
+			msg = err.Value
+		}
+
+		if msg != tt.expected {
+			t.Errorf("tests[%d] wrong error. expected=%q, got=%q", i, tt.expected, msg)
+		}
+	}
+}
@@ -1,21 +1,27 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 
 	"monkey/ast"
+	"monkey/diagnostic"
 	"monkey/lexer"
 	"monkey/token"
 )
 
 const (
-	_ int = iota // assign values 1 to 7 for the constants to get precedence
+	_ int = iota // assign increasing values to the constants to get precedence
 	LOWEST
+	ASSIGN      // = OR += OR -= OR *= OR /=
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
 	LESSGREATER // > OR <
-	SUM         // +
-	PRODUCT     // *
+	SUM         // + OR - OR | OR ^, bitwise operators bind like in go
+	PRODUCT     // * OR / OR % OR & OR << OR >>
 	PREFIX      // -X OR !X
 	CALL        // MyFunction(x)
 	INDEX       // [1]
@@ -25,16 +31,35 @@ const (
 var precedences = map[token.TokenType]int{
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
+	token.OR:       OR,
+	token.AND:      AND,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.LT_EQ:    LESSGREATER,
+	token.GT_EQ:    LESSGREATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
+	token.BIT_OR:   SUM,
+	token.BIT_XOR:  SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.PERCENT:  PRODUCT,
+	token.BIT_AND:  PRODUCT,
+	token.SHL:      PRODUCT,
+	token.SHR:      PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
 }
 
+// errors reported by a parser before it gives up, the rest are summed up as too many errors
+const maxErrors = 10
+
 type (
 	// only right side of exp
 	prefixParseFn func() ast.Expression
@@ -46,9 +71,20 @@ type (
 type Parser struct {
 	l *lexer.Lexer
 
-	errors    []string
-	curToken  token.Token
-	peekToken token.Token
+	diagnostics []diagnostic.Diagnostic
+	lexerErrors int // number of lexer diagnostics already copied into diagnostics
+	curToken    token.Token
+	peekToken   token.Token
+	loopDepth   int // loops enclosing the current statement, break and continue need one
+	braces      int // braces opened before curToken and not closed yet
+	forHeaders  int // for loop headers being parsed, semicolons inside them dont end statements
+
+	// set by a syntax error until the failed statement is skipped, errors reported in the
+	// meantime are follow-on errors and are dropped
+	panicking bool
+
+	// names declared by each function being parsed, true for constants. the innermost function is last
+	scopes []map[string]bool
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -56,13 +92,15 @@ type Parser struct {
 
 func NewParser(l *lexer.Lexer) (p *Parser) {
 	p = &Parser{
-		l:      l,
-		errors: []string{},
+		l:           l,
+		diagnostics: []diagnostic.Diagnostic{},
+		scopes:      []map[string]bool{{}},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.regPrefix(token.IDENT, p.parseIdentifier)
 	p.regPrefix(token.INT, p.parseInteger)
+	p.regPrefix(token.FLOAT, p.parseFloat)
 	p.regPrefix(token.STRING, p.parseString)
 	p.regPrefix(token.BANG, p.parsePrefixExpression)
 	p.regPrefix(token.MINUS, p.parsePrefixExpression)
@@ -72,16 +110,32 @@ func NewParser(l *lexer.Lexer) (p *Parser) {
 	p.regPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.regPrefix(token.LBRACKET, p.parseArray)
 	p.regPrefix(token.LBRACE, p.parseHashLiteral)
+	p.regPrefix(token.IF, p.parseIfExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.regInfix(token.PLUS, p.parseInfixExpression)
 	p.regInfix(token.MINUS, p.parseInfixExpression)
 	p.regInfix(token.SLASH, p.parseInfixExpression)
 	p.regInfix(token.ASTERISK, p.parseInfixExpression)
+	p.regInfix(token.PERCENT, p.parseInfixExpression)
+	p.regInfix(token.BIT_AND, p.parseInfixExpression)
+	p.regInfix(token.BIT_OR, p.parseInfixExpression)
+	p.regInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.regInfix(token.SHL, p.parseInfixExpression)
+	p.regInfix(token.SHR, p.parseInfixExpression)
 	p.regInfix(token.EQ, p.parseInfixExpression)
 	p.regInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.regInfix(token.LT, p.parseInfixExpression)
 	p.regInfix(token.GT, p.parseInfixExpression)
+	p.regInfix(token.LT_EQ, p.parseInfixExpression)
+	p.regInfix(token.GT_EQ, p.parseInfixExpression)
+	p.regInfix(token.AND, p.parseInfixExpression)
+	p.regInfix(token.OR, p.parseInfixExpression)
+	p.regInfix(token.ASSIGN, p.parseAssignExpression)
+	p.regInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.regInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.regInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.regInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
 	p.regInfix(token.LPAREN, p.parseCallExpression)
 	p.regInfix(token.LBRACKET, p.parseIndexExpression)
 
@@ -113,50 +167,262 @@ func (p *Parser) regInfix(tt token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tt] = fn
 }
 
+// lexer and parser errors in the order they were found
+func (p *Parser) Diagnostics() []diagnostic.Diagnostic {
+	return p.diagnostics
+}
+
+// the diagnostics as pos: message strings
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := make([]string, len(p.diagnostics))
+	for i, d := range p.diagnostics {
+		errors[i] = d.String()
+	}
+	return errors
+}
+
+func newError(code diagnostic.Code, tk token.Token, format string, a ...interface{}) diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Start:    tk.Pos,
+		End:      tk.End,
+	}
+}
+
+// records an error spanning tk
+func (p *Parser) addError(code diagnostic.Code, tk token.Token, format string, a ...interface{}) {
+	p.report(newError(code, tk, format, a...))
+}
+
+// records an error after which the parser lost track of the current statement, the statement
+// is dropped and the parser resumes at the next one
+func (p *Parser) syntaxError(code diagnostic.Code, tk token.Token, format string, a ...interface{}) {
+	p.addError(code, tk, format, a...)
+	p.panicking = true
+}
+
+func (p *Parser) report(d diagnostic.Diagnostic) {
+	if p.panicking {
+		return
+	}
+	p.appendDiagnostic(d)
+}
+
+func (p *Parser) appendDiagnostic(d diagnostic.Diagnostic) {
+	switch {
+	case len(p.diagnostics) < maxErrors:
+		p.diagnostics = append(p.diagnostics, d)
+	case len(p.diagnostics) == maxErrors:
+		p.diagnostics = append(p.diagnostics, diagnostic.Diagnostic{
+			Severity: diagnostic.Error,
+			Code:     diagnostic.TooManyErrors,
+			Message:  "too many errors",
+		})
+	}
+}
+
+// tokens that can be suggested when they are missing, they are always spelled the same
+var punctuation = map[token.TokenType]bool{
+	token.ASSIGN:    true,
+	token.COMMA:     true,
+	token.SEMICOLON: true,
+	token.COLON:     true,
+	token.LPAREN:    true,
+	token.RPAREN:    true,
+	token.LBRACE:    true,
+	token.RBRACE:    true,
+	token.RBRACKET:  true,
 }
 
 func (p *Parser) peekError(tk token.TokenType) {
-	err := fmt.Sprintf("expected next token to be %s, got %s instead", tk, p.peekToken.Type)
-	p.errors = append(p.errors, err)
+	d := newError(diagnostic.UnexpectedToken, p.peekToken, "expected next token to be %s, got %s instead", tk, p.peekToken.Type)
+
+	if punctuation[tk] {
+		d.FixIts = []diagnostic.FixIt{{
+			Message: fmt.Sprintf("did you mean `%s`?", tk),
+			Start:   p.curToken.End,
+			End:     p.curToken.End,
+			Text:    string(tk),
+		}}
+	}
+
+	p.report(d)
+	p.panicking = true
 }
 
 func (p *Parser) nextToken() {
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.braces++
+	case token.RBRACE:
+		p.braces = max(p.braces-1, 0)
+	}
+
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	// comments are trivia for the parser
+	for p.peekToken.Type == token.COMMENT {
+		p.peekToken = p.l.NextToken()
+	}
+
+	// lexer errors are reported in the order their tokens are read
+	lexerErrors := p.l.Diagnostics()
+	for _, d := range lexerErrors[p.lexerErrors:] {
+		p.appendDiagnostic(d)
+	}
+	p.lexerErrors = len(lexerErrors)
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
-	program.Statements = []ast.Statement{}
+	program.Statements = p.parseStatements(token.EOF)
+	return program
+}
+
+// parses statements up to end, a statement with a syntax error is left out of the result.
+// parsing stops early once there are too many errors
+func (p *Parser) parseStatements(end token.TokenType) []ast.Statement {
+	statements := []ast.Statement{}
+
+	// a block inside a statement that already failed recovers on its own
+	panicking := p.panicking
+	p.panicking = false
 
-	for p.curToken.Type != token.EOF {
+	for p.curToken.Type != end && p.curToken.Type != token.EOF && len(p.diagnostics) <= maxErrors {
+		start, braces, forHeaders := p.curToken, p.braces, p.forHeaders
 		st := p.parseStatement()
 
-		if st != nil {
-			program.Statements = append(program.Statements, st)
+		if p.panicking {
+			p.panicking = false
+			resume := p.synchronize(start, braces, forHeaders)
+			p.forHeaders = forHeaders
+
+			if resume {
+				continue
+			}
+		} else if st != nil {
+			statements = append(statements, st)
 		}
 		p.nextToken()
 	}
-	return program
+
+	p.panicking = panicking
+	return statements
 }
 
+// skips the rest of a statement that failed to parse, braces and forHeaders are the parser
+// state at its start. the statement ends at a semicolon outside of the braces and for headers
+// it opened, at the brace closing its block, before a statement keyword or before the brace
+// closing the enclosing block. curToken is left on the last skipped token, or true is returned
+// when curToken already belongs to what follows the statement
+func (p *Parser) synchronize(start token.Token, braces, forHeaders int) bool {
+	// braces opened by the statement up to and including curToken
+	depth := p.braces - braces
+	switch p.curToken.Type {
+	case token.LBRACE:
+		depth++
+	case token.RBRACE:
+		depth--
+	}
+
+	if depth < 0 || p.curToken.Type == token.EOF {
+		return p.curToken != start
+	}
+
+	if p.curToken != start && depth == 0 && p.forHeaders == forHeaders && isStatementKeyword(p.curToken.Type) {
+		return true
+	}
+
+	parens := 0
+	for {
+		if p.curToken.Type == token.SEMICOLON && depth == 0 && p.forHeaders == forHeaders {
+			return false
+		}
+
+		switch p.peekToken.Type {
+		case token.EOF:
+			return false
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				return false
+			}
+			depth--
+		case token.LPAREN:
+			parens++
+		case token.RPAREN:
+			// closes the header of a for loop that failed to parse
+			if parens == 0 && depth == 0 && p.forHeaders > forHeaders {
+				p.forHeaders--
+			} else if parens > 0 {
+				parens--
+			}
+		default:
+			if depth == 0 && p.forHeaders == forHeaders && isStatementKeyword(p.peekToken.Type) {
+				return false
+			}
+		}
+
+		p.nextToken()
+
+		if p.curToken.Type == token.RBRACE && depth == 0 && p.forHeaders == forHeaders &&
+			p.peekToken.Type != token.ELSE && p.peekToken.Type != token.SEMICOLON {
+			return false
+		}
+	}
+}
+
+func isStatementKeyword(t token.TokenType) bool {
+	switch t {
+	case token.LET, token.CONST, token.RETURN, token.IF, token.WHILE, token.FOR, token.BREAK, token.CONTINUE:
+		return true
+	}
+	return false
+}
+
+// statement parse functions return ast.Statement so a failed parse is an untyped nil
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
 	case token.IF:
 		return p.parseIfStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
-func (p *Parser) parseIfStatement() *ast.IfStatement {
-	is := &ast.IfStatement{Token: p.curToken}
+// if at the start of a statement, the same syntax as the expression form
+func (p *Parser) parseIfStatement() ast.Statement {
+	ie, ok := p.parseIfExpression().(*ast.IfExpression)
+	if !ok {
+		return nil
+	}
+
+	return &ast.IfStatement{
+		Token:       ie.Token,
+		Condition:   ie.Condition,
+		Consequence: ie.Consequence,
+		Alternative: ie.Alternative,
+	}
+}
+
+func (p *Parser) parseIfExpression() ast.Expression {
+	is := &ast.IfExpression{Token: p.curToken}
 
 	if !p.expectPeek(token.LPAREN) {
 		return nil
@@ -189,8 +455,122 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 	return is
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
-	st := &ast.LetStatement{Token: p.curToken}
+func (p *Parser) parseWhileStatement() ast.Statement {
+	ws := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	ws.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	ws.Body = p.parseLoopBody()
+
+	return ws
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	fs := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.forHeaders++
+
+	p.nextToken()
+
+	if p.curToken.Type != token.SEMICOLON {
+		fs.Init = p.parseForClause()
+
+		// the clause already consumed its semicolon when it had one
+		if p.curToken.Type != token.SEMICOLON && !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+
+	if p.curToken.Type != token.SEMICOLON {
+		fs.Condition = p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	if p.peekToken.Type != token.RPAREN {
+		p.nextToken()
+		fs.Post = p.parseForClause()
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	p.forHeaders--
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	fs.Body = p.parseLoopBody()
+
+	return fs
+}
+
+// init and post clauses of a for loop
+func (p *Parser) parseForClause() ast.Statement {
+	if p.curToken.Type == token.LET || p.curToken.Type == token.CONST {
+		return p.parseLetStatement()
+	}
+	return p.parseExpressionStatement()
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseBreakStatement() ast.Statement {
+	st := &ast.BreakStatement{Token: p.curToken}
+
+	if p.loopDepth == 0 {
+		p.addError(diagnostic.LoopControl, p.curToken, "break outside of loop")
+	}
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+	return st
+}
+
+func (p *Parser) parseContinueStatement() ast.Statement {
+	st := &ast.ContinueStatement{Token: p.curToken}
+
+	if p.loopDepth == 0 {
+		p.addError(diagnostic.LoopControl, p.curToken, "continue outside of loop")
+	}
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+	return st
+}
+
+// let and const statements, they only differ in the binding being assignable
+func (p *Parser) parseLetStatement() ast.Statement {
+	st := &ast.LetStatement{Token: p.curToken, Const: p.curToken.Type == token.CONST}
 
 	// verify if token type is IDENTIFIER
 	if !p.expectPeek(token.IDENT) {
@@ -200,6 +580,11 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	// create identifier node
 	st.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
+	// declaring a constant again, even with let, would make it assignable
+	if p.scopes[len(p.scopes)-1][st.Name.Value] {
+		p.addError(diagnostic.ConstRedeclaration, p.curToken, "cannot redeclare constant: %s", st.Name.Value)
+	}
+
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -208,6 +593,13 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	st.Value = p.parseExpression(LOWEST)
 
+	// lets the compiler know the binding name so the function can call itself
+	if fn, ok := st.Value.(*ast.FunctionLiteral); ok {
+		fn.Name = st.Name.Value
+	}
+
+	p.declare(st.Name.Value, st.Const)
+
 	if p.peekToken.Type == token.SEMICOLON {
 		p.nextToken()
 	}
@@ -215,7 +607,21 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return st
 }
 
-func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+func (p *Parser) declare(name string, constant bool) {
+	p.scopes[len(p.scopes)-1][name] = constant
+}
+
+// reports whether name refers to a constant, the innermost declaration wins
+func (p *Parser) isConstant(name string) bool {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if constant, ok := p.scopes[i][name]; ok {
+			return constant
+		}
+	}
+	return false
+}
+
+func (p *Parser) parseReturnStatement() ast.Statement {
 	st := &ast.ReturnStatement{Token: p.curToken}
 
 	p.nextToken()
@@ -228,7 +634,7 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return st
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+func (p *Parser) parseExpressionStatement() ast.Statement {
 	// defer untrace(trace("parseExpressionStatement"))
 	st := &ast.ExpressionStatement{Token: p.curToken}
 	st.Expression = p.parseExpression(LOWEST) // we pass the lowest precedence operator because we didnt parse anything yet, so we cant compare precedence
@@ -243,17 +649,10 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
-	block.Statements = []ast.Statement{}
 
 	p.nextToken()
 
-	for p.curToken.Type != token.RBRACE && p.curToken.Type != token.EOF {
-		st := p.parseStatement()
-		if st != nil {
-			block.Statements = append(block.Statements, st)
-		}
-		p.nextToken()
-	}
+	block.Statements = p.parseStatements(token.RBRACE)
 	return block
 }
 
@@ -266,9 +665,16 @@ func (p *Parser) parseInteger() ast.Expression {
 	intLiteral := &ast.IntegerLiteral{Token: p.curToken}
 
 	val, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		// literals past int64 are BigIntegers, like the results of overflowing arithmetic
+		if bi, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			intLiteral.Big = bi
+			return intLiteral
+		}
+	}
+
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as int", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.syntaxError(diagnostic.InvalidNumber, p.curToken, "could not parse %q as int", p.curToken.Literal)
 		return nil
 	}
 	intLiteral.Value = val
@@ -276,6 +682,19 @@ func (p *Parser) parseInteger() ast.Expression {
 	return intLiteral
 }
 
+func (p *Parser) parseFloat() ast.Expression {
+	floatLiteral := &ast.FloatLiteral{Token: p.curToken}
+
+	val, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.syntaxError(diagnostic.InvalidNumber, p.curToken, "could not parse %q as float", p.curToken.Literal)
+		return nil
+	}
+	floatLiteral.Value = val
+
+	return floatLiteral
+}
+
 func (p *Parser) parseArray() ast.Expression {
 	a := &ast.ArrayLiteral{Token: p.curToken}
 	l := []ast.Expression{}
@@ -294,11 +713,10 @@ func (p *Parser) parseArray() ast.Expression {
 		l = append(l, p.parseExpression(LOWEST))
 	}
 
-	if p.peekToken.Type != token.RBRACKET {
-		p.nextToken()
-		l = nil
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
 	}
-	p.nextToken()
+
 	a.Elements = l
 	return a
 }
@@ -309,11 +727,9 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	p.nextToken()
 	e.Index = p.parseExpression(LOWEST)
 
-	if p.peekToken.Type != token.RBRACKET {
-		p.nextToken()
+	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
-	p.nextToken()
 
 	return e
 }
@@ -326,31 +742,20 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		key := p.parseExpression(LOWEST)
 
-		if p.peekToken.Type != token.COLON {
-			p.nextToken()
+		if !p.expectPeek(token.COLON) {
 			return nil
 		}
 
-		p.nextToken()
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
 
-		if p.peekToken.Type != token.RBRACE {
-			if p.peekToken.Type != token.COMMA {
-				p.nextToken()
-				return nil
-			}
-			p.nextToken()
+		if p.peekToken.Type != token.RBRACE && !p.expectPeek(token.COMMA) {
+			return nil
 		}
 	}
 
-	if p.peekToken.Type != token.RBRACE {
-		p.nextToken()
-		return nil
-	}
-
 	p.nextToken()
 	return hash
 }
@@ -396,15 +801,38 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// assignments are right associative, a = b = 1 assigns 1 to b and then to a
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Target:   target,
+		Operator: p.curToken.Literal,
+	}
+
+	switch target := target.(type) {
+	case *ast.Identifier:
+		if p.isConstant(target.Value) {
+			p.addError(diagnostic.ConstAssignment, p.curToken, "cannot assign to constant: %s", target.Value)
+		}
+	case *ast.IndexExpression:
+	default:
+		p.syntaxError(diagnostic.InvalidAssignment, p.curToken, "cannot assign to %s", target.String())
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+
+	return expression
+}
+
 func (p *Parser) parseGroupedExpressions() ast.Expression {
 	p.nextToken()
 
 	expression := p.parseExpression(LOWEST)
 
-	if p.peekToken.Type != token.RPAREN {
+	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
-	p.nextToken()
 	return expression
 }
 
@@ -413,63 +841,105 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		Token: p.curToken,
 	}
 
-	if p.peekToken.Type != token.LPAREN {
+	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
-	p.nextToken()
 
-	fn.Arguments = p.parseFunctionArguments()
+	// parameters are assignable and shadow constants of the enclosing functions
+	p.scopes = append(p.scopes, map[string]bool{})
+	defer func() { p.scopes = p.scopes[:len(p.scopes)-1] }()
+
+	// loops around the literal dont belong to its defaults or body
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = loopDepth }()
 
-	if p.peekToken.Type != token.LBRACE {
+	if !p.parseFunctionArguments(fn) {
 		return nil
 	}
 
-	p.nextToken()
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
 
 	fn.Body = p.parseBlockStatement()
 
 	return fn
 }
 
-func (p *Parser) parseFunctionArguments() []*ast.Identifier {
-	ids := []*ast.Identifier{}
+// parses the parameters up to the ), like a, b = 2, ...rest. parameters with a default value
+// come after the required ones and the rest parameter is the last one
+func (p *Parser) parseFunctionArguments(fn *ast.FunctionLiteral) bool {
+	fn.Arguments = []*ast.Identifier{}
 
 	if p.peekToken.Type == token.RPAREN {
 		p.nextToken() // advance token to rparen and return
-		return ids
+		return true
 	}
 
-	p.nextToken() // advance token to next id
+	defaults := []ast.Expression{}
+	hasDefaults := false
 
-	id := &ast.Identifier{
-		Token: p.curToken,
-		Value: p.curToken.Literal,
-	}
+	for {
+		if p.peekToken.Type == token.ELLIPSIS {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
 
-	ids = append(ids, id)
+			fn.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			p.declareParameter(fn.Rest)
+			break
+		}
 
-	for p.peekToken.Type == token.COMMA {
-		p.nextToken() // advance token to comma
-		p.nextToken() // advance token to next id
+		if !p.expectPeek(token.IDENT) { // advance token to next id
+			return false
+		}
 
-		id := &ast.Identifier{
-			Token: p.curToken,
-			Value: p.curToken.Literal,
+		id := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		var value ast.Expression
+
+		// the default is parsed before the parameter is declared, it only sees the ones before it
+		if p.peekToken.Type == token.ASSIGN {
+			p.nextToken()
+			p.nextToken()
+			value = p.parseExpression(ASSIGN)
+			hasDefaults = true
+		} else if hasDefaults {
+			p.addError(diagnostic.MissingDefault, id.Token, "parameter %s needs a default value, it follows a parameter with one", id.Value)
 		}
 
-		ids = append(ids, id)
+		fn.Arguments = append(fn.Arguments, id)
+		defaults = append(defaults, value)
+		p.declareParameter(id)
+
+		if p.peekToken.Type != token.COMMA {
+			break
+		}
+		p.nextToken() // advance token to comma
 	}
 
-	if p.peekToken.Type != token.RPAREN {
-		return nil
+	if hasDefaults {
+		fn.Defaults = defaults
 	}
-	p.nextToken()
-	return ids
+
+	return p.expectPeek(token.RPAREN)
+}
+
+// parameters share the function scope, a repeated name would silently shadow the first one
+func (p *Parser) declareParameter(id *ast.Identifier) {
+	if _, ok := p.scopes[len(p.scopes)-1][id.Value]; ok {
+		p.addError(diagnostic.DuplicateParameter, id.Token, "duplicate parameter: %s", id.Value)
+	}
+	p.declare(id.Value, false)
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	call := &ast.CallExpression{Token: p.curToken, Function: function}
 	call.Arguments = p.parseCallArguments()
+	if call.Arguments == nil {
+		return nil
+	}
 	return call
 }
 
@@ -483,25 +953,40 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 
 	p.nextToken()
 
-	args = append(args, p.parseExpression(LOWEST))
+	args = append(args, p.parseCallArgument())
 
 	for p.peekToken.Type == token.COMMA {
 		p.nextToken()
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		args = append(args, p.parseCallArgument())
 	}
 
-	if p.peekToken.Type != token.RPAREN {
+	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
+	return args
+}
+
+// ...value spreads an array into separate arguments
+func (p *Parser) parseCallArgument() ast.Expression {
+	if p.curToken.Type != token.ELLIPSIS {
+		return p.parseExpression(LOWEST)
+	}
 
+	spread := &ast.SpreadExpression{Token: p.curToken}
 	p.nextToken()
-	return args
+	spread.Value = p.parseExpression(LOWEST)
+
+	return spread
 }
 
 func (p *Parser) noPrefixParseError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	// illegal tokens were already reported by the lexer
+	if t == token.ILLEGAL {
+		p.panicking = true
+		return
+	}
+	p.syntaxError(diagnostic.ExpectedExpression, p.curToken, "no prefix parse function for %s found", t)
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
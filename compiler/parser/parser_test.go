@@ -2,9 +2,13 @@ package parser
 
 import (
 	"fmt"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
 	"monkey/ast"
+	"monkey/diagnostic"
 	"monkey/lexer"
 )
 
@@ -157,6 +161,74 @@ func TestIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestPrefixedIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xff;", 255},
+		{"0o17;", 15},
+		{"0b1010;", 10},
+		{"1_000_000;", 1000000},
+		{"0x_7f_ff;", 32767},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		st := program.Statements[0].(*ast.ExpressionStatement)
+		integer, ok := st.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral, instead=%T", st.Expression)
+		}
+
+		if integer.Value != tt.expected {
+			t.Errorf("integer.Value not %d, got=%d", tt.expected, integer.Value)
+		}
+	}
+}
+
+func TestBigIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775808;", "9223372036854775808"},
+		{"0xFFFFFFFFFFFFFFFF;", "18446744073709551615"},
+		{"1_000_000_000_000_000_000_000;", "1000000000000000000000"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		st := program.Statements[0].(*ast.ExpressionStatement)
+		integer, ok := st.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral, instead=%T", st.Expression)
+		}
+
+		if integer.Big == nil || integer.Big.String() != tt.expected {
+			t.Errorf("integer.Big not %s, got=%v", tt.expected, integer.Big)
+		}
+	}
+
+	// literals that fit keep using Value
+	p := NewParser(lexer.New("9223372036854775807;"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	integer := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+	if integer.Big != nil || integer.Value != 9223372036854775807 {
+		t.Errorf("wrong literal. got Value=%d Big=%v", integer.Value, integer.Big)
+	}
+}
+
 func TestPrefixOperator(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -277,6 +349,46 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"-a * b",
 			"((-a) * b)",
 		},
+		{
+			"a + b % c",
+			"(a + (b % c))",
+		},
+		{
+			"a | b & c",
+			"(a | (b & c))",
+		},
+		{
+			"a ^ b << 2",
+			"(a ^ (b << 2))",
+		},
+		{
+			"a & 1 == 0",
+			"((a & 1) == 0)",
+		},
+		{
+			"a >> 1 < b | c",
+			"((a >> 1) < (b | c))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a == b && c < d + 1",
+			"((a == b) && (c < (d + 1)))",
+		},
+		{
+			"!a || b",
+			"((!a) || b)",
+		},
 		{
 			"!-a",
 			"(!(-a))",
@@ -381,6 +493,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a = b = c + 1",
+			"(a = (b = (c + 1)))",
+		},
+		{
+			"x += y * 2 || z",
+			"(x += ((y * 2) || z))",
+		},
+		{
+			"a[i] -= f(b)",
+			"((a[i]) -= f(b))",
+		},
 	}
 	for _, tt := range tests {
 		l := lexer.New(tt.input)
@@ -506,6 +630,189 @@ func TestIfExpression(t *testing.T) {
 	}
 }
 
+func TestIfInExpressionPosition(t *testing.T) {
+	input := `let max = if (x > y) { x } else { y };`
+	l := lexer.New(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Body does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T",
+			program.Statements[0])
+	}
+	exp, ok := stmt.Value.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.IfExpression. got=%T", stmt.Value)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", ">", "y") {
+		return
+	}
+	if exp.Alternative == nil || len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("alternative is not 1 statements. got=%+v", exp.Alternative)
+	}
+	if exp.String() != "if(x > y) xelse y" {
+		t.Errorf("exp.String() wrong. got=%q", exp.String())
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < y) { x; break; }`
+	l := lexer.New(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Body does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("body is not 2 statements. got=%d\n", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("body.Statements[1] is not ast.BreakStatement. got=%T", stmt.Body.Statements[1])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let i = 0; i < 10; let i = i + 1) { continue; }", "for (let i = 0; (i < 10); let i = (i + 1)) continue;"},
+		{"for (i; i; i) { }", "for (i; i; i) "},
+		{"for (;;) { break }", "for (; ; ) break;"},
+		{"for (; i < 3;) { i }", "for (; (i < 3); ) i"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Body does not contain %d statements. got=%d\n",
+				1, len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T",
+				program.Statements[0])
+		}
+
+		if stmt.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestLoopControlOutsideOfLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside of loop"},
+		{"if (true) { continue; }", "1:13: continue outside of loop"},
+		{"while (true) { let f = fn() { break; }; }", "1:31: break outside of loop"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser error for %q", tt.input)
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestConstStatement(t *testing.T) {
+	input := "const x = 5; let y = x;"
+	l := lexer.New(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	for i, expected := range []bool{true, false} {
+		st, ok := program.Statements[i].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("program.Statements[%d] is not ast.LetStatement. got=%T", i, program.Statements[i])
+		}
+
+		if st.Const != expected {
+			t.Errorf("program.Statements[%d].Const wrong. expected=%t, got=%t", i, expected, st.Const)
+		}
+	}
+
+	if program.String() != "const x = 5;let y = x;" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestConstAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const x = 1; x = 2;", "1:16: cannot assign to constant: x"},
+		{"const x = 1; let f = fn() { x += 1 };", "1:31: cannot assign to constant: x"},
+		{"let x = 1; const x = 2; x *= 3;", "1:27: cannot assign to constant: x"},
+		{"const x = 1; let x = 2;", "1:18: cannot redeclare constant: x"},
+		{"const x = 1; const x = 2;", "1:20: cannot redeclare constant: x"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser error for %q", tt.input)
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+
+	// parameters and lets of inner functions shadow the constant
+	for _, input := range []string{
+		"const x = 1; let f = fn(x) { x = 2 };",
+		"const x = 1; let f = fn() { let x = 2; x = 3 };",
+		"const a = [1]; a[0] = 2;",
+	} {
+		p := NewParser(lexer.New(input))
+		p.ParseProgram()
+		checkParserErrors(t, p)
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 	l := lexer.New(input)
@@ -570,6 +877,90 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedParams   []string
+		expectedDefaults []string
+		expectedRest     string
+		expectedString   string
+	}{
+		{"fn(a, b = 2) {}", []string{"a", "b"}, []string{"", "2"}, "", "fn(a, b = 2)"},
+		{"fn(a = 1, b = a * 2) {}", []string{"a", "b"}, []string{"1", "(a * 2)"}, "", "fn(a = 1, b = (a * 2))"},
+		{"fn(...rest) {}", []string{}, []string{}, "rest", "fn(...rest)"},
+		{"fn(a, b = 2, ...rest) {}", []string{"a", "b"}, []string{"", "2"}, "rest", "fn(a, b = 2, ...rest)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Arguments) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong. want %d, got=%d", len(tt.expectedParams), len(function.Arguments))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Arguments[i], ident)
+
+			var def string
+			if i < len(function.Defaults) && function.Defaults[i] != nil {
+				def = function.Defaults[i].String()
+			}
+
+			if def != tt.expectedDefaults[i] {
+				t.Errorf("default of %s wrong. want %q, got=%q", ident, tt.expectedDefaults[i], def)
+			}
+		}
+
+		var rest string
+		if function.Rest != nil {
+			rest = function.Rest.Value
+		}
+
+		if rest != tt.expectedRest {
+			t.Errorf("rest parameter wrong. want %q, got=%q", tt.expectedRest, rest)
+		}
+
+		if function.String() != tt.expectedString {
+			t.Errorf("function.String() wrong. want %q, got=%q", tt.expectedString, function.String())
+		}
+	}
+}
+
+func TestParameterErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a, a) { a }", "1:7: duplicate parameter: a"},
+		{"fn(a, ...a) { a }", "1:10: duplicate parameter: a"},
+		{"fn(a = 1, b) { a }", "1:11: parameter b needs a default value, it follows a parameter with one"},
+		{"fn(...r, b) { r }", "1:8: expected next token to be ), got , instead"},
+		{"fn(a, ...) { a }", "1:10: expected next token to be IDENT, got ) instead"},
+		{"[...x]", "1:2: no prefix parse function for ... found"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser error for %q", tt.input)
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 	l := lexer.New(input)
@@ -601,6 +992,39 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
 
+func TestCallExpressionWithSpread(t *testing.T) {
+	input := "add(...xs, 1, ...[2, 3]);"
+	l := lexer.New(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	spread, ok := exp.Arguments[0].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("exp.Arguments[0] is not ast.SpreadExpression. got=%T", exp.Arguments[0])
+	}
+	testIdentifier(t, spread.Value, "xs")
+	testLiteralExpression(t, exp.Arguments[1], 1)
+
+	if _, ok := exp.Arguments[2].(*ast.SpreadExpression); !ok {
+		t.Fatalf("exp.Arguments[2] is not ast.SpreadExpression. got=%T", exp.Arguments[2])
+	}
+
+	if exp.String() != "add(...xs, 1, ...[2, 3])" {
+		t.Errorf("exp.String() wrong. got=%q", exp.String())
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	input := `"hello world";`
 	l := lexer.New(input)
@@ -617,6 +1041,32 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9;", 1e-9},
+		{"2.5E3;", 2500},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
 func checkParserErrors(t *testing.T, p *Parser) {
 	errors := p.Errors()
 
@@ -755,3 +1205,207 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 5;", "test.mk:1:5: expected next token to be IDENT, got = instead"},
+		{"let x 5;", "test.mk:1:7: expected next token to be =, got INT instead"},
+		{"let x = 1;\n  let y = );", "test.mk:2:11: no prefix parse function for ) found"},
+		{"09", "test.mk:1:1: leading zero in integer literal 09, octal literals use the 0o prefix"},
+		{"let x = 1; /* open", "test.mk:1:12: unterminated block comment"},
+		{"let s = \"open;", "test.mk:1:9: unterminated string literal"},
+		{"1e+;", "test.mk:1:1: malformed float literal 1e+, exponent has no digits"},
+		{"1e999;", "test.mk:1:1: could not parse \"1e999\" as float"},
+		{"let x = 0x;", "test.mk:1:9: malformed hex literal 0x, no digits"},
+		{"1 = 2;", "test.mk:1:3: cannot assign to 1"},
+		{"a + b = c;", "test.mk:1:7: cannot assign to (a + b)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewWithFilename(tt.input, "test.mk")
+		p := NewParser(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q, got none", tt.input)
+			continue
+		}
+
+		if p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser error. expected=%q, got=%q", tt.expected, p.Errors()[0])
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input    string
+		errors   []string
+		expected string
+	}{
+		{"let x 5; let y = 1; y", []string{"1:7: expected next token to be =, got INT instead"}, "let y = 1;y"},
+		{"let x = ; let y = 2;", []string{"1:9: no prefix parse function for ; found"}, "let y = 2;"},
+		{"let x = 1\nlet y = \nlet z = 3", []string{"3:1: no prefix parse function for LET found"}, "let x = 1;let z = 3;"},
+		{"if (x { let a = 1; } let b = 2;", []string{"1:7: expected next token to be ), got { instead"}, "let b = 2;"},
+		{"if (x { a } else { b } c;", []string{"1:7: expected next token to be ), got { instead"}, "c"},
+		{"for (let i = 0; i < ; i += 1) { i } let z = 1;", []string{"1:21: no prefix parse function for ; found"}, "let z = 1;"},
+		{"let f = fn(1, b) { b }; f(2)", []string{"1:12: expected next token to be IDENT, got INT instead"}, "f(2)"},
+		{"let f = fn(a) { let = 1; a }; f(2)", []string{"1:21: expected next token to be IDENT, got = instead"}, "let f = fn(a)a;f(2)"},
+		{"fn() { if (a) { b = } }; 7", []string{"1:21: no prefix parse function for } found"}, "fn()ifa 7"},
+		{"(1 + 2; 3", []string{"1:7: expected next token to be ), got ; instead"}, "3"},
+		{"f(1, 2; g()", []string{"1:7: expected next token to be ), got ; instead"}, "g()"},
+		{"a[1; b", []string{"1:4: expected next token to be ], got ; instead"}, "b"},
+		{"{1: 2, 3 4}; 5", []string{"1:10: expected next token to be :, got INT instead"}, "5"},
+		{"let a = 1 @ 2; a", []string{"1:11: illegal character '@'"}, "let a = 1;a"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+
+		if !slices.Equal(p.Errors(), tt.errors) {
+			t.Errorf("wrong errors for %q. expected=%q, got=%q", tt.input, tt.errors, p.Errors())
+		}
+
+		// failed statements are left out, never added as nil
+		for i, st := range program.Statements {
+			if st == nil || reflect.ValueOf(st).IsNil() {
+				t.Fatalf("program.Statements[%d] is nil for %q", i, tt.input)
+			}
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestTooManyErrors(t *testing.T) {
+	input := strings.Repeat("1 +;", maxErrors+5)
+
+	l := lexer.New(input)
+	p := NewParser(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != maxErrors+1 {
+		t.Fatalf("wrong number of errors. expected=%d, got=%d", maxErrors+1, len(errors))
+	}
+
+	if errors[maxErrors] != "too many errors" {
+		t.Errorf("last error wrong. got=%q", errors[maxErrors])
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input       string
+		code        diagnostic.Code
+		startColumn int
+		endColumn   int
+		fixIt       string
+		fixColumn   int // fix-its insert right after the last token before the error
+	}{
+		{"let a = (1 + 2 ;", diagnostic.UnexpectedToken, 16, 17, ")", 15},
+		{"let a = [1, 2;", diagnostic.UnexpectedToken, 14, 15, "]", 14},
+		{"let 5 = 1;", diagnostic.UnexpectedToken, 5, 6, "", 0},
+		{"let a = 1 +;", diagnostic.ExpectedExpression, 12, 13, "", 0},
+		{"const a = 1; a += 2;", diagnostic.ConstAssignment, 16, 18, "", 0},
+		{"1 = 2;", diagnostic.InvalidAssignment, 3, 4, "", 0},
+		{"break;", diagnostic.LoopControl, 1, 6, "", 0},
+		{"let a = 1 @ 2;", diagnostic.IllegalCharacter, 11, 12, "", 0},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		if len(p.Diagnostics()) != 1 {
+			t.Fatalf("%s - expected 1 diagnostic, got=%v", tt.input, p.Errors())
+		}
+
+		d := p.Diagnostics()[0]
+		if d.Code != tt.code {
+			t.Errorf("%s - wrong code. expected=%s, got=%s", tt.input, tt.code, d.Code)
+		}
+
+		if d.Start.Column != tt.startColumn || d.End.Column != tt.endColumn {
+			t.Errorf("%s - wrong range. expected=%d-%d, got=%d-%d",
+				tt.input, tt.startColumn, tt.endColumn, d.Start.Column, d.End.Column)
+		}
+
+		if tt.fixIt == "" {
+			if len(d.FixIts) != 0 {
+				t.Errorf("%s - unexpected fix-its %+v", tt.input, d.FixIts)
+			}
+			continue
+		}
+
+		if len(d.FixIts) != 1 || d.FixIts[0].Text != tt.fixIt || d.FixIts[0].Start != d.FixIts[0].End {
+			t.Fatalf("%s - expected insertion of %q, got=%+v", tt.input, tt.fixIt, d.FixIts)
+		}
+
+		if d.FixIts[0].Message != fmt.Sprintf("did you mean `%s`?", tt.fixIt) {
+			t.Errorf("%s - wrong fix-it message. got=%q", tt.input, d.FixIts[0].Message)
+		}
+
+		if d.FixIts[0].Start.Column != tt.fixColumn {
+			t.Errorf("%s - wrong fix-it column. expected=%d, got=%d", tt.input, tt.fixColumn, d.FixIts[0].Start.Column)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// header
+let x = 10 /* ten */ / 2; // half
+x`
+
+	l := lexer.New(input)
+	l.KeepComments(true)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if program.String() != "let x = (10 / 2);x" {
+		t.Errorf("wrong program. got=%q", program.String())
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := "let add = fn(a, b) {\n  a + b\n};\nadd(1, 2);"
+	l := lexer.New(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	body := fn.Body.Statements[0].(*ast.ExpressionStatement)
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, "1:1"},
+		{let, "1:1"},
+		{let.Name, "1:5"},
+		{fn, "1:11"},
+		{body.Expression, "2:5"},
+		{call, "4:4"},
+		{call.Function, "4:1"},
+		{call.Arguments[1], "4:8"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.expected {
+			t.Errorf("tests[%d] - wrong position for %q. expected=%s, got=%s",
+				i, tt.node.String(), tt.expected, tt.node.Pos())
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"strings"
 
+	"monkey/diagnostic"
 	"monkey/eval"
 	"monkey/lexer"
 	"monkey/object"
@@ -36,7 +38,7 @@ func CheckParser(in io.Reader, out io.Writer) {
 		p := parser.NewParser(l)
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+			printParserErrors(out, p.Diagnostics(), line)
 			continue
 		}
 		io.WriteString(out, program.String())
@@ -44,9 +46,9 @@ func CheckParser(in io.Reader, out io.Writer) {
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+func printParserErrors(out io.Writer, diagnostics []diagnostic.Diagnostic, source string) {
+	for _, d := range diagnostics {
+		io.WriteString(out, "\t"+strings.ReplaceAll(d.Render(source), "\n", "\n\t")+"\n")
 	}
 }
 
@@ -77,13 +79,16 @@ func REPL(in io.Reader, out io.Writer) error {
 		prog := p.ParseProgram()
 
 		if len(p.Errors()) != 0 {
-			printErrors(out, p.Errors())
+			printErrors(out, p.Diagnostics(), line)
 			continue
 		}
 
 		evaluated := eval.Eval(prog, env)
 
-		if evaluated != nil {
+		if err, ok := evaluated.(*object.Error); ok {
+			io.WriteString(out, err.Traceback())
+			io.WriteString(out, "\n")
+		} else if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
@@ -91,10 +96,8 @@ func REPL(in io.Reader, out io.Writer) error {
 	}
 }
 
-func printErrors(out io.Writer, errors []string) {
+func printErrors(out io.Writer, diagnostics []diagnostic.Diagnostic, source string) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "Looks like we ran into some monkey business here...\nparser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
-	}
+	printParserErrors(out, diagnostics, source)
 }
@@ -1,19 +1,44 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // position of the first character of the token
+	End     Position // position right after the last character of the token
+}
+
+type Position struct {
+	Filename string
+	Offset   int // byte offset, starting at 0
+	Line     int // starting at 1
+	Column   int // starting at 1, counted in characters
+}
+
+// positions built by hand, like in tests, have no line
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// file:line:col, or line:col when there is no file
+func (p Position) String() string {
+	s := fmt.Sprintf("%d:%d", p.Line, p.Column)
+	if p.Filename != "" {
+		s = p.Filename + ":" + s
+	}
+	return s
 }
 
 const (
 	ILLEGAL = "ILLEGAL" // illegal token
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // only emitted when the lexer keeps comments
 
 	// identifiers + literals
 	IDENT  = "IDENT" // idx, x, y, etc
 	INT    = "INT"   // 1, 2, 3, etc
+	FLOAT  = "FLOAT" // 3.14, 1e-9, etc
 	STRING = "STRING"
 
 	// operators
@@ -23,10 +48,26 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
+	BIT_AND  = "&"
+	BIT_OR   = "|"
+	BIT_XOR  = "^"
+	SHL      = "<<"
+	SHR      = ">>"
 	LT       = "<"
 	GT       = ">"
 	EQ       = "=="
 	NOT_EQ   = "!="
+	LT_EQ    = "<="
+	GT_EQ    = ">="
+	AND      = "&&"
+	OR       = "||"
+
+	// compound assignments
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
 
 	// delimiters
 	COMMA     = ","
@@ -38,25 +79,36 @@ const (
 	RBRACE    = "}"
 	LBRACKET  = "["
 	RBRACKET  = "]"
+	ELLIPSIS  = "..." // rest parameters and spread arguments
 
 	// keywords
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"return": RETURN,
-	"if":     IF,
-	"else":   ELSE,
-	"true":   TRUE,
-	"false":  FALSE,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"const":    CONST,
+	"return":   RETURN,
+	"if":       IF,
+	"else":     ELSE,
+	"while":    WHILE,
+	"for":      FOR,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"true":     TRUE,
+	"false":    FALSE,
 }
 
 func LookupIdent(ident string) TokenType {
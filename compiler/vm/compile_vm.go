@@ -1,29 +1,28 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
-	"io"
 	"monkey/compiler"
+	"monkey/diagnostic"
 	"monkey/lexer"
 	"monkey/parser"
 	"os"
+	"strings"
 )
 
 func CompileRunVM(path string) error {
-	var out io.Writer
-
 	f, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
 
-	l := lexer.New(string(f))
+	l := lexer.NewWithFilename(string(f), path)
 	p := parser.NewParser(l)
 	prog := p.ParseProgram()
 
 	if len(p.Errors()) != 0 {
-		printErrors(out, p.Errors())
-		return err
+		return parserErrors(p.Diagnostics(), string(f))
 	}
 
 	c := compiler.New()
@@ -42,9 +41,12 @@ func CompileRunVM(path string) error {
 	return nil
 }
 
-func printErrors(out io.Writer, errors []string) {
-	io.WriteString(out, "Looks like we ran into some monkey business here...\nparser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, msg)
+// renders the parser errors against the source, returned so the command prints them and fails
+func parserErrors(diagnostics []diagnostic.Diagnostic, source string) error {
+	var b strings.Builder
+	b.WriteString("Looks like we ran into some monkey business here...\nparser errors:")
+	for _, d := range diagnostics {
+		b.WriteString("\n\t" + strings.ReplaceAll(d.Render(source), "\n", "\n\t"))
 	}
+	return errors.New(b.String())
 }
@@ -0,0 +1,53 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/object"
+)
+
+// call frame, holds the execution state of a function call
+type Frame struct {
+	cl          *object.Closure
+	ip          int   // instruction pointer inside the function
+	basePointer int   // stack pointer before the call, locals live right above it
+	loops       []int // stack pointer at the entry of each loop being executed, innermost last
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// storage of a local captured by a closure. the function and its closures read and write the
+// value through the cell, so they see each other's assignments
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return "CELL" }
+func (c *cell) Inspect() string         { return fmt.Sprintf("Cell[%p]", c) }
+
+// value of a local or free variable, looking through its cell when it was captured
+func deref(obj object.Object) object.Object {
+	if c, ok := obj.(*cell); ok {
+		return c.value
+	}
+	return obj
+}
+
+// argument pushed by OpSpread, OpCall replaces it with the elements of the array
+type spread struct {
+	elements []object.Object
+}
+
+func (s *spread) Type() object.ObjectType { return "SPREAD" }
+func (s *spread) Inspect() string         { return fmt.Sprintf("Spread[%p]", s) }
+
+func isSpread(obj object.Object) bool {
+	_, ok := obj.(*spread)
+	return ok
+}
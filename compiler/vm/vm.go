@@ -2,26 +2,93 @@ package vm
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
 	"monkey/code"
 	"monkey/compiler"
 	"monkey/object"
+	"slices"
+)
+
+var (
+	True  = &object.Boolean{Value: true}
+	False = &object.Boolean{Value: false}
+	Null  = &object.Null{}
+)
+
+// operator symbols, used to build the same error messages as the evaluator
+var operators = map[code.Opcode]string{
+	code.OpAdd:                "+",
+	code.OpSub:                "-",
+	code.OpMul:                "*",
+	code.OpDiv:                "/",
+	code.OpMod:                "%",
+	code.OpBitAnd:             "&",
+	code.OpBitOr:              "|",
+	code.OpBitXor:             "^",
+	code.OpShiftLeft:          "<<",
+	code.OpShiftRight:         ">>",
+	code.OpEqual:              "==",
+	code.OpNotEqual:           "!=",
+	code.OpGreaterThan:        ">",
+	code.OpGreaterThanOrEqual: ">=",
+	code.OpLessThan:           "<",
+	code.OpLessThanOrEqual:    "<=",
+}
+
+const (
+	MaxFrames   = 1024
+	StackSize   = MaxFrames * 16 // room for the locals and operands of every frame, calls nest MaxFrames deep
+	GlobalsSize = 65536          // max index addressable by the 2 byte operand of OpSetGlobal
 )
 
 type VM struct {
-	constants    []object.Object
-	instructions code.Instructions
-	stack        []object.Object // expressions are objects in memory
-	sp           int             // stack pointer, always points to the next value
+	constants []object.Object
+	stack     []object.Object // expressions are objects in memory
+	sp        int             // stack pointer, always points to the next value
+	globals   []object.Object // values bound with let at the top level
+
+	frames      []*Frame
+	framesIndex int // always points to the next frame
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
+	// the main program runs as a function without locals
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
 	return &VM{
-		constants:    bytecode.Constants,
-		instructions: bytecode.Instructions,
-		stack:        make([]object.Object, 2048),
-		sp:           0,
+		constants:   bytecode.Constants,
+		stack:       make([]object.Object, StackSize),
+		sp:          0,
+		globals:     make([]object.Object, GlobalsSize),
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow: more than %d nested calls", MaxFrames-1)
 	}
+
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
 }
 
 func (vm *VM) StackTop() object.Object {
@@ -37,29 +104,287 @@ func (vm *VM) LastPoppedStackElement() object.Object {
 }
 
 func (vm *VM) Run() error {
-	for ipointer := 0; ipointer < len(vm.instructions); ipointer++ {
-		op := code.Opcode(vm.instructions[ipointer])
+	if err := vm.run(); err != nil {
+		return vm.runtimeError(err)
+	}
+	return nil
+}
+
+// positions the error at the instruction being executed, the frames below it are the calls
+// the error propagates out of
+func (vm *VM) runtimeError(err error) *object.Error {
+	frame := vm.currentFrame()
+	pos := frame.cl.Fn.SourceMap.Lookup(frame.ip)
+	rtErr := &object.Error{Value: err.Error(), Pos: pos}
+
+	for i := vm.framesIndex - 1; i > 0; i-- {
+		callee, caller := vm.frames[i], vm.frames[i-1]
+		rtErr.Stack = append(rtErr.Stack, object.CallSite{
+			Function: callee.cl.Fn.Name,
+			Pos:      caller.cl.Fn.SourceMap.Lookup(caller.ip),
+		})
+	}
+	return rtErr
+}
+
+func (vm *VM) run() error {
+	var ipointer int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ipointer = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ipointer])
 
 		switch op {
 		case code.OpPop:
 			vm.pop()
+		case code.OpDup2:
+			if err := vm.push(vm.stack[vm.sp-2]); err != nil {
+				return err
+			}
+			if err := vm.push(vm.stack[vm.sp-2]); err != nil {
+				return err
+			}
 		case code.OpConstant:
-			constPoolIdx := binary.BigEndian.Uint16(vm.instructions[ipointer+1:]) // get constpoolidx by decoding instructions
-			ipointer += 2                                                         // increment the number of bytes
+			constPoolIdx := binary.BigEndian.Uint16(ins[ipointer+1:]) // get constpoolidx by decoding instructions
+			vm.currentFrame().ip += 2                                 // increment the number of bytes
 
 			if err := vm.push(vm.constants[constPoolIdx]); err != nil {
 				return err
 			}
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
 			if err := vm.executeBinOp(op); err != nil {
 				return err
 			}
 		case code.OpTrue:
-			if err := vm.push(&object.Boolean{Value: true}); err != nil {
+			if err := vm.push(True); err != nil {
 				return err
 			}
 		case code.OpFalse:
-			if err := vm.push(&object.Boolean{Value: false}); err != nil {
+			if err := vm.push(False); err != nil {
+				return err
+			}
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual, code.OpLessThan,
+			code.OpLessThanOrEqual:
+			if err := vm.executeComparison(op); err != nil {
+				return err
+			}
+		case code.OpBang:
+			if err := vm.executeBangOperator(); err != nil {
+				return err
+			}
+		case code.OpMinus:
+			if err := vm.executeMinusOperator(); err != nil {
+				return err
+			}
+		case code.OpJump:
+			pos := int(binary.BigEndian.Uint16(ins[ipointer+1:]))
+			vm.currentFrame().ip = pos - 1 // loop increments ip
+		case code.OpJumpNotTruthy:
+			pos := int(binary.BigEndian.Uint16(ins[ipointer+1:]))
+			vm.currentFrame().ip += 2
+
+			if !isTruthy(vm.pop()) {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpEnterLoop:
+			frame := vm.currentFrame()
+			frame.loops = append(frame.loops, vm.sp)
+		case code.OpExitLoop:
+			frame := vm.currentFrame()
+			frame.loops = frame.loops[:len(frame.loops)-1]
+		case code.OpUnwindLoop:
+			// drops the operands of the expressions the break or continue jumps out of
+			frame := vm.currentFrame()
+			vm.sp = frame.loops[len(frame.loops)-1]
+		case code.OpNull:
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+		case code.OpSetGlobal:
+			globalIdx := binary.BigEndian.Uint16(ins[ipointer+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIdx] = vm.pop()
+		case code.OpGetGlobal:
+			globalIdx := binary.BigEndian.Uint16(ins[ipointer+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(vm.globals[globalIdx]); err != nil {
+				return err
+			}
+		case code.OpSetLocal:
+			localIdx := int(ins[ipointer+1])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			slot := &vm.stack[frame.basePointer+localIdx]
+			if c, ok := (*slot).(*cell); ok {
+				c.value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
+		case code.OpGetLocal:
+			localIdx := int(ins[ipointer+1])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			if err := vm.push(deref(vm.stack[frame.basePointer+localIdx])); err != nil {
+				return err
+			}
+		case code.OpCaptureLocal:
+			localIdx := int(ins[ipointer+1])
+			vm.currentFrame().ip += 1
+
+			// the local moves into a cell the first time a closure captures it
+			frame := vm.currentFrame()
+			slot := &vm.stack[frame.basePointer+localIdx]
+			c, ok := (*slot).(*cell)
+			if !ok {
+				c = &cell{value: *slot}
+				*slot = c
+			}
+
+			if err := vm.push(c); err != nil {
+				return err
+			}
+		case code.OpCall:
+			numArgs := int(ins[ipointer+1])
+			vm.currentFrame().ip += 1
+
+			if err := vm.executeCall(numArgs); err != nil {
+				return err
+			}
+		case code.OpClosure:
+			constIdx := int(binary.BigEndian.Uint16(ins[ipointer+1:]))
+			numFree := int(ins[ipointer+3])
+			vm.currentFrame().ip += 3
+
+			if err := vm.pushClosure(constIdx, numFree); err != nil {
+				return err
+			}
+		case code.OpGetFree:
+			freeIdx := int(ins[ipointer+1])
+			vm.currentFrame().ip += 1
+
+			if err := vm.push(deref(vm.currentFrame().cl.Free[freeIdx])); err != nil {
+				return err
+			}
+		case code.OpSetFree:
+			freeIdx := int(ins[ipointer+1])
+			vm.currentFrame().ip += 1
+
+			free := vm.currentFrame().cl.Free
+			if c, ok := free[freeIdx].(*cell); ok {
+				c.value = vm.pop()
+			} else {
+				free[freeIdx] = vm.pop()
+			}
+		case code.OpCaptureFree:
+			freeIdx := int(ins[ipointer+1])
+			vm.currentFrame().ip += 1
+
+			// nested closures share the cell of the enclosing one
+			if err := vm.push(vm.currentFrame().cl.Free[freeIdx]); err != nil {
+				return err
+			}
+		case code.OpGetBuiltin:
+			builtinIdx := int(ins[ipointer+1])
+			vm.currentFrame().ip += 1
+
+			if err := vm.push(object.Builtins[builtinIdx].Builtin); err != nil {
+				return err
+			}
+		case code.OpCurrentClosure:
+			if err := vm.push(vm.currentFrame().cl); err != nil {
+				return err
+			}
+		case code.OpSkipDefault:
+			localIdx := int(ins[ipointer+1])
+			pos := int(binary.BigEndian.Uint16(ins[ipointer+2:]))
+			vm.currentFrame().ip += 3
+
+			// callClosure leaves the locals of missing arguments nil
+			frame := vm.currentFrame()
+			if vm.stack[frame.basePointer+localIdx] != nil {
+				frame.ip = pos - 1
+			}
+		case code.OpSpread:
+			value := vm.pop()
+			array, ok := value.(*object.Array)
+			if !ok {
+				return fmt.Errorf("spread operator not supported: %s", value.Type())
+			}
+
+			if err := vm.push(&spread{elements: array.Elements}); err != nil {
+				return err
+			}
+		case code.OpArray:
+			numElements := int(binary.BigEndian.Uint16(ins[ipointer+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(array); err != nil {
+				return err
+			}
+		case code.OpHash:
+			numElements := int(binary.BigEndian.Uint16(ins[ipointer+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(hash); err != nil {
+				return err
+			}
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := vm.executeIndexExpression(left, index); err != nil {
+				return err
+			}
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := object.SetIndex(left, index, value); err != nil {
+				return errors.New(err.Value)
+			}
+
+			if err := vm.push(value); err != nil {
+				return err
+			}
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// return at the top level ends the program, the value stays as the last popped element
+			if vm.framesIndex == 1 {
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1 // also removes the function from the stack
+
+			if err := vm.push(returnValue); err != nil {
+				return err
+			}
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(Null); err != nil {
 				return err
 			}
 		}
@@ -67,8 +392,126 @@ func (vm *VM) Run() error {
 	return nil
 }
 
+func (vm *VM) executeCall(numArgs int) error {
+	numArgs, err := vm.expandSpreads(numArgs)
+	if err != nil {
+		return err
+	}
+
+	// the callee sits below its arguments on the stack
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+// replaces the spread arguments on top of the stack with their elements, returns the number
+// of arguments after that
+func (vm *VM) expandSpreads(numArgs int) (int, error) {
+	start := vm.sp - numArgs
+	args := vm.stack[start:vm.sp]
+
+	// calls without spreads are the common case, they dont allocate
+	if !slices.ContainsFunc(args, isSpread) {
+		return numArgs, nil
+	}
+
+	expanded := []object.Object{}
+	for _, arg := range args {
+		if s, ok := arg.(*spread); ok {
+			expanded = append(expanded, s.elements...)
+		} else {
+			expanded = append(expanded, arg)
+		}
+	}
+
+	if start+len(expanded) >= StackSize {
+		return 0, fmt.Errorf("stack overflow")
+	}
+
+	copy(vm.stack[start:], expanded)
+	vm.sp = start + len(expanded)
+	return len(expanded), nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	// errors abort the program like in the evaluator
+	if err, ok := result.(*object.Error); ok {
+		return errors.New(err.Value)
+	}
+
+	if result == nil {
+		return vm.push(Null)
+	}
+	return vm.push(result)
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	fn := cl.Fn
+	if err := object.CheckArity(numArgs, fn.NumParameters-fn.NumDefaults, fn.NumParameters, fn.Variadic); err != nil {
+		return errors.New(err.Value)
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+
+	// the extra arguments move into the array of the rest parameter, the local after the others
+	var rest *object.Array
+	if fn.Variadic {
+		rest = &object.Array{Elements: []object.Object{}}
+		if numArgs > fn.NumParameters {
+			rest.Elements = append(rest.Elements, vm.stack[frame.basePointer+fn.NumParameters:vm.sp]...)
+			numArgs = fn.NumParameters
+		}
+	}
+
+	// arguments are the first locals, the rest of the locals are reserved after them
+	vm.sp = frame.basePointer + fn.NumLocals
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	// the slots can still hold values or cells of a previous call, let must not write into them
+	for i := frame.basePointer + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+
+	if rest != nil {
+		vm.stack[frame.basePointer+fn.NumParameters] = rest
+	}
+	return nil
+}
+
+// wraps the function constant in a closure with the free variables on top of the stack
+func (vm *VM) pushClosure(constIdx, numFree int) error {
+	constant := vm.constants[constIdx]
+	fn, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp = vm.sp - numFree
+
+	return vm.push(&object.Closure{Fn: fn, Free: free})
+}
+
 func (vm *VM) push(o object.Object) error {
-	if vm.sp >= 2048 {
+	if vm.sp >= StackSize {
 		return fmt.Errorf("stack overflow")
 	}
 
@@ -91,13 +534,62 @@ func (vm *VM) executeBinOp(op code.Opcode) error {
 		return vm.executeBinIntOp(op, r, l)
 	}
 
-	return fmt.Errorf("unsuported type for binop: %s, %s", r.Type(), l.Type())
+	if isNumber(r) && isNumber(l) {
+		// at least one side is a float, the integer side is converted
+		return vm.executeBinFloatOp(op, r, l)
+	}
+
+	if r.Type() == object.STRING_OBJ && l.Type() == object.STRING_OBJ && op == code.OpAdd {
+		rValue := r.(*object.String).Value
+		lValue := l.(*object.String).Value
+		return vm.push(&object.String{Value: lValue + rValue})
+	}
+
+	if l.Type() != r.Type() {
+		return fmt.Errorf("type mismatch: %s %s %s", l.Type(), operators[op], r.Type())
+	}
+	return fmt.Errorf("unknown operator: %s %s %s", l.Type(), operators[op], r.Type())
 }
 
 func (vm *VM) executeBinIntOp(op code.Opcode, r, l object.Object) error {
-	rValue := r.(*object.Integer).Value
-	lValue := l.(*object.Integer).Value
-	var res int64
+	// results that overflow an int64 are promoted to big integers
+	var res object.Object
+	switch op {
+	case code.OpAdd:
+		res = object.AddIntegers(l, r)
+	case code.OpSub:
+		res = object.SubIntegers(l, r)
+	case code.OpMul:
+		res = object.MulIntegers(l, r)
+	case code.OpDiv:
+		res = object.DivIntegers(l, r)
+	case code.OpMod:
+		res = object.ModIntegers(l, r)
+	case code.OpBitAnd:
+		res = object.AndIntegers(l, r)
+	case code.OpBitOr:
+		res = object.OrIntegers(l, r)
+	case code.OpBitXor:
+		res = object.XorIntegers(l, r)
+	case code.OpShiftLeft:
+		res = object.ShiftLeftIntegers(l, r)
+	case code.OpShiftRight:
+		res = object.ShiftRightIntegers(l, r)
+	default:
+		return fmt.Errorf("unknown integer op: %d", op)
+	}
+
+	// division by zero and bad shift counts abort the program like in the evaluator
+	if err, ok := res.(*object.Error); ok {
+		return errors.New(err.Value)
+	}
+	return vm.push(res)
+}
+
+func (vm *VM) executeBinFloatOp(op code.Opcode, r, l object.Object) error {
+	rValue := toFloat(r)
+	lValue := toFloat(l)
+	var res float64
 	switch op {
 	case code.OpAdd:
 		res = lValue + rValue
@@ -107,8 +599,235 @@ func (vm *VM) executeBinIntOp(op code.Opcode, r, l object.Object) error {
 		res = lValue * rValue
 	case code.OpDiv:
 		res = lValue / rValue
+	case code.OpMod:
+		res = math.Mod(lValue, rValue)
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", l.Type(), operators[op], r.Type())
+	}
+	return vm.push(&object.Float{Value: res})
+}
+
+func (vm *VM) buildArray(start, end int) object.Object {
+	elements := make([]object.Object, end-start)
+
+	for i := start; i < end; i++ {
+		elements[i-start] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(start, end int) (object.Object, error) {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i := start; i < end; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}, nil
+}
+
+// same rules as eval.evalIndexExpression, missing elements are null
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	default:
+		return fmt.Errorf("index operator not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	a := array.(*object.Array)
+	idx, ok := index.(*object.Integer)
+	if !ok {
+		// big integers are always out of range
+		return vm.push(Null)
+	}
+	i := idx.Value
+
+	maxIndex := int64(len(a.Elements) - 1)
+	if i < 0 || i > maxIndex {
+		return vm.push(Null)
+	}
+
+	return vm.push(a.Elements[i])
+}
+
+// strings are indexed by character, not by byte
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	runes := []rune(str.(*object.String).Value)
+	idx, ok := index.(*object.Integer)
+	if !ok || idx.Value < 0 || idx.Value >= int64(len(runes)) {
+		return vm.push(Null)
+	}
+
+	return vm.push(&object.String{Value: string(runes[idx.Value])})
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	h := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := h.Pairs[key.HashKey()]
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(pair.Value)
+}
+
+func (vm *VM) executeComparison(op code.Opcode) error {
+	r := vm.pop()
+	l := vm.pop()
+
+	switch {
+	case r.Type() == object.INTEGER_OBJ && l.Type() == object.INTEGER_OBJ:
+		return vm.executeIntComparison(op, r, l)
+	case isNumber(r) && isNumber(l):
+		return vm.executeFloatComparison(op, r, l)
+	case r.Type() == object.STRING_OBJ && l.Type() == object.STRING_OBJ:
+		return vm.executeStringComparison(op, r, l)
+	case op == code.OpEqual:
+		// booleans are singletons, so everything else is compared by identity like in eval
+		return vm.push(nativeBoolToBooleanObj(r == l))
+	case op == code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObj(r != l))
+	case l.Type() != r.Type():
+		return fmt.Errorf("type mismatch: %s %s %s", l.Type(), operators[op], r.Type())
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", l.Type(), operators[op], r.Type())
+	}
+}
+
+func (vm *VM) executeIntComparison(op code.Opcode, r, l object.Object) error {
+	cmp := object.CompareIntegers(l, r)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObj(cmp == 0))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObj(cmp != 0))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObj(cmp > 0))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObj(cmp >= 0))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObj(cmp < 0))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObj(cmp <= 0))
 	default:
 		return fmt.Errorf("unknown integer op: %d", op)
 	}
-	return vm.push(&object.Integer{Value: res})
+}
+
+func (vm *VM) executeFloatComparison(op code.Opcode, r, l object.Object) error {
+	rValue := toFloat(r)
+	lValue := toFloat(l)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObj(lValue == rValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObj(lValue != rValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObj(lValue > rValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObj(lValue >= rValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObj(lValue < rValue))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObj(lValue <= rValue))
+	default:
+		return fmt.Errorf("unknown float op: %d", op)
+	}
+}
+
+func (vm *VM) executeStringComparison(op code.Opcode, r, l object.Object) error {
+	rValue := r.(*object.String).Value
+	lValue := l.(*object.String).Value
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObj(lValue == rValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObj(lValue != rValue))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", l.Type(), operators[op], r.Type())
+	}
+}
+
+func (vm *VM) executeBangOperator() error {
+	o := vm.pop()
+
+	switch o {
+	case True:
+		return vm.push(False)
+	case False:
+		return vm.push(True)
+	case Null:
+		return vm.push(True)
+	default:
+		return vm.push(False)
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	o := vm.pop()
+
+	switch o := o.(type) {
+	case *object.Integer, *object.BigInteger:
+		return vm.push(object.NegateInteger(o))
+	case *object.Float:
+		return vm.push(&object.Float{Value: -o.Value})
+	default:
+		return fmt.Errorf("unknown operator: -%s", o.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// value of an integer or float as a float
+func toFloat(obj object.Object) float64 {
+	if f, ok := obj.(*object.Float); ok {
+		return f.Value
+	}
+	return object.IntegerToFloat(obj)
+}
+
+// same truthiness rules as eval.isTruthy
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObj(b bool) *object.Boolean {
+	if b {
+		return True
+	}
+	return False
 }
@@ -2,10 +2,14 @@ package vm
 
 import (
 	"fmt"
+	"math"
 	"monkey/compiler"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -14,10 +18,106 @@ type vmTest struct {
 	expected interface{}
 }
 
+func TestBigIntegers(t *testing.T) {
+	tests := []vmTest{
+		{"(9223372036854775807 + 1) - 1", 9223372036854775807},
+		{"(9223372036854775807 * 3) / 3", 9223372036854775807},
+		{"[1, 2][(9223372036854775807 + 1) - 9223372036854775807]", 2},
+		{"9223372036854775807 * 2 > 9223372036854775807", true},
+		{"9223372036854775807 * 2 == 9223372036854775807 + 9223372036854775807", true},
+		{`let b = 9223372036854775807 * 4; {b: "big"}[b]`, "big"},
+		{"-9223372036854775808", math.MinInt64},
+		{"9223372036854775808 - 1", 9223372036854775807},
+		{"0xFFFFFFFFFFFFFFFF > 9223372036854775807", true},
+	}
+
+	runVmTests(t, tests)
+
+	l := lexer.New("let f = fn(n) { if (n == 0) { 1 } else { n * f(n - 1) } }; f(25)")
+	prog := parser.NewParser(l).ParseProgram()
+
+	comp := compiler.New()
+	if err := comp.Compile(prog); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if got := vm.LastPoppedStackElement().Inspect(); got != "15511210043330985984000000" {
+		t.Errorf("wrong factorial. got=%s", got)
+	}
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTest{
+		{"3.14", 3.14},
+		{"-2.5", -2.5},
+		{"1.5 + 2", 3.5},
+		{"2 * 1.5", 3.0},
+		{"7 / 2.0", 3.5},
+		{"1e3 - 1", 999.0},
+		{"float(2) / 4", 0.5},
+		{"7.5 % 2", 1.5},
+		{"int(2.9) * 2", 4},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLogicalExpressions(t *testing.T) {
+	tests := []vmTest{
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 2", false},
+		{"2.5 >= 2", true},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && \"\"", true},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"false && 1 + true", false},
+		{"true || 1 + true", true},
+		{"let calls = fn() { len(1) }; false && calls()", false},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []vmTest{
 		{"true", true},
 		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"(1 > 2) == false", true},
+		{"1 == true", false},
+		{"1 != true", true},
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+		{"1 < 1.5", true},
+		{"2.5 > 3", false},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 != 0.3", true},
 	}
 
 	runVmTests(t, tests)
@@ -29,11 +129,495 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"1 - 2", -1},
 		{"1 * 2", 2},
 		{"2 / 1", 2},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+		{"1 + 2 << 1", 5},
+		{"(1 << 70) >> 69", 2},
+		{"-5", -5},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
 	}
 
 	runVmTests(t, tests)
 }
 
+func TestLoops(t *testing.T) {
+	tests := []vmTest{
+		{"let i = 0; while (i < 10) { let i = i + 1; } i", 10},
+		{"while (false) { 10 }", Null},
+		{"let i = 0; while (true) { if (i == 5) { break; } let i = i + 1; } i", 5},
+		{"let s = 0; for (let i = 0; i < 10; let i = i + 1) { if (i % 2 == 0) { continue; } let s = s + i; } s", 25},
+		{"let s = 0; for (let i = 0; i < 3; let i = i + 1) { for (let j = 0; j < 3; let j = j + 1) { if (j == 1) { break; } let s = s + 1; } } s", 3},
+		{"let f = fn(n) { for (let i = 0; ; let i = i + 1) { if (i == n) { return i * 2; } } }; f(4)", 8},
+		{"let f = fn() { let i = 0; while (i < 3) { let i = i + 1; } }; f()", Null},
+		{"let i = 0; while (i < 300000) { let i = i + 1; } i", 300000},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLoopControlInExpressions(t *testing.T) {
+	tests := []vmTest{
+		// each skipped iteration leaves 1 on the stack unless continue unwinds it
+		{"let s = 0; for (let i = 0; i < 5000; i += 1) { s = s + 1 + if (i % 2 == 0) { continue; } else { 0 }; } s", 2500},
+		{"let n = 0; while (true) { n += 1; let x = [n, if (n == 3000) { break; } else { 1 }]; } n", 3000},
+		{"let f = fn() { let n = 0; while (true) { n += 1; 5 * if (n > 10) { break; } else { 1 }; } n }; f() + f()", 22},
+		{"let n = 0; for (let i = 0; i < 3; i += 1) { for (let j = 0; j < 3; j += 1) { n = n + 1 + if (j == 1) { break; } else { 0 } } } n", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []vmTest{
+		{"let x = 1; x = x + 1; x", 2},
+		{"let x = 1; x += 2; x *= 3; x -= 1; x /= 2; x", 4},
+		{"let a = 1; let b = 2; a = b = 5; a + b", 10},
+		{"let x = 1; x = 5", 5},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		{"let s = 0; for (let i = 0; i < 5; i += 1) { s += i; } s", 10},
+		{"let arr = [1, 2, 3]; arr[1] = 20; arr[2] += 10; arr", []int{1, 20, 13}},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] += 5; h`, map[object.HashKey]int64{
+			(&object.String{Value: "a"}).HashKey(): 6,
+			(&object.String{Value: "b"}).HashKey(): 2,
+		}},
+		{"let f = fn() { let c = 0; let inc = fn() { c += 1; }; inc(); inc(); c }; f()", 2},
+		{"let counter = fn() { let c = 0; fn() { c += 1 } }; let next = counter(); next(); next(); next()", 3},
+		{"let f = fn(a) { let g = fn() { fn() { a *= 2 } }; let h = g(); h(); h(); a }; f(3)", 12},
+		{"let f = fn() { let x = 1; x = 2; let g = fn() { x }; x = 3; g() }; f()", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTest{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 } ", 20},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (false) { 10 }", Null},
+		{"if (true) { }", Null},
+		{"if (true) { if (false) { 10 } else { 20 } }", 20},
+		{"let a = 3; let b = 5; let x = if (a > b) { a } else { b }; x", 5},
+		{"1 + if (true) { 2 } else { 3 }", 3},
+		{"!(if (false) { 10 })", true},
+		{"let f = fn(x) { let y = if (x) { 1 }; y }; f(false)", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTest{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = 2; one + two", 3},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTest{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let one = fn() { 1; }; let two = fn() { 2; }; one() + two()", 3},
+		{"let a = fn() { 1 }; let b = fn() { a() + 1 }; let c = fn() { b() + 1 }; c();", 3},
+		{"let earlyExit = fn() { return 99; 100; }; earlyExit();", 99},
+		{"let earlyExit = fn() { return 99; return 100; }; earlyExit();", 99},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let noReturn = fn() { }; let noReturnTwo = fn() { noReturn(); }; noReturn(); noReturnTwo();", Null},
+		{"let returnsOne = fn() { 1; }; let returnsOneReturner = fn() { returnsOne; }; returnsOneReturner()();", 1},
+		{"let max = fn(a, b) { if (a > b) { a } else { b } }; max(3, 7);", 7},
+		{"let f = fn(a) { if (a > 1) { return 10; } 20 }; f(5) + f(0);", 30},
+		{"return 10; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithBindings(t *testing.T) {
+	tests := []vmTest{
+		{"let one = fn() { let one = 1; one }; one();", 1},
+		{"let oneAndTwo = fn() { let one = 1; let two = 2; one + two; }; oneAndTwo();", 3},
+		{`let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
+		let threeAndFour = fn() { let three = 3; let four = 4; three + four; };
+		oneAndTwo() + threeAndFour();`, 10},
+		{`let globalSeed = 50;
+		let minusOne = fn() { let num = 1; globalSeed - num; }
+		let minusTwo = fn() { let num = 2; globalSeed - num; }
+		minusOne() + minusTwo();`, 97},
+		{"let identity = fn(a) { a; }; identity(4);", 4},
+		{"let sum = fn(a, b) { a + b; }; sum(1, 2);", 3},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{"let sum = fn(a, b) { let c = a + b; c; }; let outer = fn() { sum(1, 2) + sum(3, 4); }; outer();", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []vmTest{
+		{"let add = fn(x, y = 10) { x + y }; add(5);", 15},
+		{"let add = fn(x, y = 10) { x + y }; add(5, 1);", 6},
+		{"let f = fn(x, y = x * 2, z = y + 1) { [x, y, z] }; f(1);", []int{1, 2, 3}},
+		{"let y = 100; let f = fn(x, y = y) { x + y }; f(1);", 101},
+		{"let f = fn(x) { fn(y = x + 1) { let z = y; z * 2 } }; f(1)();", 4},
+		{"let f = fn(x = if (true) { return 7 }) { x }; f();", 7},
+		{"let collect = fn(...rest) { rest }; collect();", []int{}},
+		{"let collect = fn(x, ...rest) { let n = len(rest); rest }; collect(1, 2, 3);", []int{2, 3}},
+		{"let sum = fn(...xs) { if (len(xs) == 0) { 0 } else { first(xs) + sum(...tail(xs)) } }; sum(1, 2, 3, 4);", 10},
+		{"let add = fn(x, y, z) { x + y + z }; let xs = [2, 3]; add(1, ...xs);", 6},
+		{"let add = fn(x, y, z) { x + y + z }; add(...[1], 2, ...[3]);", 6},
+		{"let f = fn(x, y = 2, ...rest) { [x, y, len(rest)] }; f(...[1, 5, 6, 7]);", []int{1, 5, 2}},
+		{"len(...[[1, 2, 3]])", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTest{
+		{"let newClosure = fn(a) { fn() { a; }; }; let closure = newClosure(99); closure();", 99},
+		{"let newAdder = fn(a, b) { fn(c) { a + b + c }; }; let adder = newAdder(1, 2); adder(8);", 11},
+		{"let newAdder = fn(a, b) { let c = a + b; fn(d) { c + d }; }; let adder = newAdder(1, 2); adder(8);", 11},
+		{`let newAdderOuter = fn(a, b) {
+			let c = a + b;
+			fn(d) {
+				let e = d + c;
+				fn(f) { e + f; };
+			};
+		};
+		let newAdderInner = newAdderOuter(1, 2)
+		let adder = newAdderInner(3);
+		adder(8);`, 14},
+		{`let a = 1;
+		let newAdderOuter = fn(b) {
+			fn(c) {
+				fn(d) { a + b + c + d };
+			};
+		};
+		let newAdderInner = newAdderOuter(2)
+		let adder = newAdderInner(3);
+		adder(8);`, 14},
+		{`let newClosure = fn(a, b) {
+			let one = fn() { a; };
+			let two = fn() { b; };
+			fn() { one() + two(); };
+		};
+		let closure = newClosure(9, 90);
+		closure();`, 99},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveClosures(t *testing.T) {
+	tests := []vmTest{
+		{`let countDown = fn(x) {
+			if (x == 0) {
+				return 0;
+			} else {
+				countDown(x - 1);
+			}
+		};
+		countDown(1);`, 0},
+		{`let wrapper = fn() {
+			let countDown = fn(x) {
+				if (x == 0) {
+					return 0;
+				} else {
+					countDown(x - 1);
+				}
+			};
+			countDown(1);
+		};
+		wrapper();`, 0},
+		{`let sum = fn(n, f) {
+			let iterator = fn(i, acc) {
+				if (i == 0) {
+					acc
+				} else {
+					iterator(i - 1, f(acc, i));
+				}
+			};
+			iterator(n, 0);
+		};
+		sum(10, fn(total, e) { total + e });`, 55},
+		{`let fibonacci = fn(x) {
+			if (x == 0) {
+				return 0;
+			} else {
+				if (x == 1) {
+					return 1;
+				} else {
+					fibonacci(x - 1) + fibonacci(x - 2);
+				}
+			}
+		};
+		fibonacci(15);`, 610},
+		// recursion as deep as the frames allow fits the stack
+		{`let depth = fn(x) { if (x == 0) { 0 } else { 1 + depth(x - 1) } };
+		depth(1000);`, 1000},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTest{
+		{`"monkey"`, "monkey"},
+		{`"mon" + "key"`, "monkey"},
+		{`"mon" + "key" + "banana"`, "monkeybanana"},
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`let a = "str"; let b = "str"; a == b`, true},
+		{`1 == "1"`, false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []vmTest{
+		{"[]", []int{}},
+		{"[1, 2, 3]", []int{1, 2, 3}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []vmTest{
+		{"{}", map[object.HashKey]int64{}},
+		{"{1: 2, 2: 3}", map[object.HashKey]int64{
+			(&object.Integer{Value: 1}).HashKey(): 2,
+			(&object.Integer{Value: 2}).HashKey(): 3,
+		}},
+		{"{1 + 1: 2 * 2, 3 + 3: 4 * 4}", map[object.HashKey]int64{
+			(&object.Integer{Value: 2}).HashKey(): 4,
+			(&object.Integer{Value: 6}).HashKey(): 16,
+		}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTest{
+		{"[1, 2, 3][1]", 2},
+		{`"héllo"[1]`, "é"},
+		{`"日本語"[2]`, "語"},
+		{`"abc"[3]`, Null},
+		{"[1, 2, 3][0 + 2]", 3},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[][0]", Null},
+		{"[1, 2, 3][99]", Null},
+		{"[1][-1]", Null},
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{1: 1, 2: 2}[2]", 2},
+		{`{"foo": 5}["foo"]`, 5},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{true: 5}[true]`, 5},
+		{"{1: 1}[0]", Null},
+		{"{}[0]", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTest{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`count("abca", "a")`, 2},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, Null},
+		{`tail([1, 2, 3])`, []int{2, 3}},
+		{`tail([])`, Null},
+		{`push([], 1)`, []int{1}},
+		{`let len = fn(x) { 42 }; len([])`, 42},
+		{`let map = fn(arr, f) {
+			let iterator = fn(arr, acc) {
+				if (len(arr) == 0) {
+					acc
+				} else {
+					iterator(tail(arr), push(acc, f(first(arr))));
+				}
+			};
+			iterator(arr, []);
+		};
+		map([1, 2, 3, 4], fn(x) { x * 3 });`, []int{3, 6, 9, 12}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"true + false", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"true > false", "unknown operator: BOOLEAN > BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"fn() { 1; }(1);", "wrong number of arguments. got=1, want=0"},
+		{"fn(a) { a; }();", "wrong number of arguments. got=0, want=1"},
+		{"fn(a, b) { a + b; }(1);", "wrong number of arguments. got=1, want=2"},
+		{"1(2);", "not a function: INTEGER"},
+		{"1 / 0", "division by zero"},
+		{"let x = 0; 10 % x", "division by zero"},
+		{"1 << -1", "negative shift count: -1"},
+		{"1.5 & 1", "unknown operator: FLOAT & INTEGER"},
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{`"a" > "b"`, "unknown operator: STRING > STRING"},
+		{`"a" < "b"`, "unknown operator: STRING < STRING"},
+		{`1 < "a"`, "type mismatch: INTEGER < STRING"},
+		{"true <= false", "unknown operator: BOOLEAN <= BOOLEAN"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+		{`1[0]`, "index operator not supported: INTEGER"},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{"let a = [1]; a[1] = 2", "index out of range: 1"},
+		{`let a = [1]; a["x"] = 2`, "array index must be INTEGER, got STRING"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+		{`let h = {}; h[[1]] = 2`, "unusable as hash key: ARRAY"},
+		{"fn(a, b = 2) { a }()", "wrong number of arguments. got=0, want=1..2"},
+		{"fn(a, b = 2) { a }(1, 2, 3)", "wrong number of arguments. got=3, want=1..2"},
+		{"fn(a, ...rest) { a }()", "wrong number of arguments. got=0, want>=1"},
+		{"fn(a) { a }(...1)", "spread operator not supported: INTEGER"},
+		{"let f = fn(x) { f(x + 1) }; f(0)", "stack overflow: more than 1023 nested calls"},
+		{"let f = fn(x) { let a = [x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, f(x + 1)]; a }; f(0)", "stack overflow"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.NewParser(l)
+		prog := p.ParseProgram()
+
+		comp := compiler.New()
+		if err := comp.Compile(prog); err != nil {
+			t.Fatalf("compiler error %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("expected vm error %q, got none", tt.expected)
+		}
+
+		errObj, ok := err.(*object.Error)
+		if !ok {
+			t.Fatalf("vm error is not *object.Error, got %T", err)
+		}
+
+		if errObj.Value != tt.expected {
+			t.Errorf("wrong vm error, got %q, want %q", errObj.Value, tt.expected)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 +\n  true", "1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn(a) {\n  a + 1;\n};\nf(true);", "2:5: type mismatch: BOOLEAN + INTEGER"},
+		{"let a = [1];\n\n  len(a, a)", "3:6: wrong number of arguments. got=2, want=1"},
+		{"let f = fn(x) {\n  f(x + 1)\n};\nf(0);", "2:4: stack overflow: more than 1023 nested calls"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewWithFilename(tt.input, "")
+		p := parser.NewParser(l)
+		prog := p.ParseProgram()
+
+		comp := compiler.New()
+		if err := comp.Compile(prog); err != nil {
+			t.Fatalf("compiler error %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("expected vm error %q, got none", tt.expected)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong vm error, got %q, want %q", err.Error(), tt.expected)
+		}
+	}
+}
+
+func TestErrorCallStack(t *testing.T) {
+	input := `let inner = fn(x) {
+  x + true
+};
+let outer = fn(y) { inner(y) };
+outer(1);`
+
+	l := lexer.NewWithFilename(input, "")
+	comp := compiler.New()
+	if err := comp.Compile(parser.NewParser(l).ParseProgram()); err != nil {
+		t.Fatalf("compiler error %s", err)
+	}
+
+	err := New(comp.Bytecode()).Run()
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		t.Fatalf("vm error is not *object.Error, got %T", err)
+	}
+
+	// the same traceback as the evaluator
+	traceback := "ERROR: 2:5: type mismatch: INTEGER + BOOLEAN\n" +
+		"\tin inner, called at 4:26\n" +
+		"\tin outer, called at 5:6"
+	if errObj.Traceback() != traceback {
+		t.Errorf("wrong traceback, got %q, want %q", errObj.Traceback(), traceback)
+	}
+}
+
+func TestCompileRunVMParserErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.mk")
+	if err := os.WriteFile(path, []byte("let = 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the command fails with the rendered parser errors
+	expected := "parser errors:\n\t" + path + ":1:5: error: expected next token to be IDENT, got = instead"
+
+	err := CompileRunVM(path)
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("wrong error, got %v, want it to contain %q", err, expected)
+	}
+}
+
 func testIntegerObject(e int64, a object.Object) error {
 	r, ok := a.(*object.Integer)
 	if !ok {
@@ -47,6 +631,32 @@ func testIntegerObject(e int64, a object.Object) error {
 	return nil
 }
 
+func testFloatObject(e float64, a object.Object) error {
+	r, ok := a.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float, got %T", a)
+	}
+
+	if r.Value != e {
+		return fmt.Errorf("wrong value, got %g, want %g", r.Value, e)
+	}
+
+	return nil
+}
+
+func testStringObject(e string, a object.Object) error {
+	r, ok := a.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String, got %T", a)
+	}
+
+	if r.Value != e {
+		return fmt.Errorf("wrong value, got %q, want %q", r.Value, e)
+	}
+
+	return nil
+}
+
 func testBooleanObject(e bool, a object.Object) error {
 	r, ok := a.(*object.Boolean)
 	if !ok {
@@ -95,5 +705,57 @@ func testExpectedObj(t *testing.T, e interface{}, a object.Object) {
 		if err := testBooleanObject(bool(e), a); err != nil {
 			t.Errorf("testing bool failed %s", err)
 		}
+	case float64:
+		if err := testFloatObject(e, a); err != nil {
+			t.Errorf("testing float failed %s", err)
+		}
+	case string:
+		if err := testStringObject(e, a); err != nil {
+			t.Errorf("testing string failed %s", err)
+		}
+	case []int:
+		array, ok := a.(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array, got %T (%+v)", a, a)
+			return
+		}
+
+		if len(array.Elements) != len(e) {
+			t.Errorf("wrong number of elements, got %d, want %d", len(array.Elements), len(e))
+			return
+		}
+
+		for i, el := range e {
+			if err := testIntegerObject(int64(el), array.Elements[i]); err != nil {
+				t.Errorf("testing integer failed %s", err)
+			}
+		}
+	case map[object.HashKey]int64:
+		hash, ok := a.(*object.Hash)
+		if !ok {
+			t.Errorf("object is not Hash, got %T (%+v)", a, a)
+			return
+		}
+
+		if len(hash.Pairs) != len(e) {
+			t.Errorf("wrong number of pairs, got %d, want %d", len(hash.Pairs), len(e))
+			return
+		}
+
+		for k, v := range e {
+			pair, ok := hash.Pairs[k]
+			if !ok {
+				t.Errorf("no pair for given key in Pairs")
+				continue
+			}
+
+			if err := testIntegerObject(v, pair.Value); err != nil {
+				t.Errorf("testing integer failed %s", err)
+			}
+		}
+	case *object.Null:
+		if a != Null {
+			t.Errorf("object is not Null, got %T (%+v)", a, a)
+		}
 	}
 }
@@ -1,10 +1,9 @@
-let a = fn(b) {
-	if(b == 300000) {
-		return b;
-	}
-	if(b < 3000000) {
-		a(b+1);
+let a = fn(n) {
+	let b = 1;
+	for (let i = 1; i < n; i = i + 1) {
+		b += 1;
 	}
+	b;
 }
 
-a(1);
+a(300000);
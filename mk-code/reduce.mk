@@ -1,3 +1,4 @@
+// folds arr into a single value, starting from total
 let reduce = fn(arr, total, f) {
 	let iterator = fn(arr, res) {
 		if(len(arr) == 0) {